@@ -3,12 +3,12 @@ package cmd
 import (
 	"fmt"
 
+	"github.com/dpastoor/plr/internal/redact"
 	"github.com/spf13/cobra"
 )
 
 func debugCmd(cfg *settings, args []string) {
-	fmt.Printf("%#v\n", cfg)
-
+	fmt.Println(redact.String(fmt.Sprintf("%#v", cfg)))
 }
 
 func newDebugCmd(cfg *settings) *cobra.Command {
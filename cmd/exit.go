@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dpastoor/plr/internal/results"
+)
+
+// exit codes of plr run, any other error exits with 1
+const (
+	// exitSessionsFailed means at least one session ended in an outcome selected by --fail-on
+	exitSessionsFailed = 2
+	// exitThresholdsBreached means at least one threshold in the scenarios was breached
+	exitThresholdsBreached = 3
+	// exitInterrupted means the run was cut short by SIGINT or SIGTERM
+	exitInterrupted = 130
+)
+
+// exitError is an error that should end plr with a specific exit code
+type exitError struct {
+	code int
+	err  error
+}
+
+func newExitError(code int, format string, args ...interface{}) *exitError {
+	return &exitError{code: code, err: fmt.Errorf(format, args...)}
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// runExit decides how a finished run exits, returning nil when it passed.
+// An interrupt takes precedence over breached thresholds, which take
+// precedence over a circuit breaker abort and then sessions ending in
+// one of the failOn outcomes
+func runExit(sig os.Signal, report results.Report, records []results.Record, failOn []string) error {
+	if sig != nil {
+		return newExitError(exitInterrupted, "run interrupted by %s", sig)
+	}
+	if breached := results.Breached(report.Thresholds); len(breached) > 0 {
+		return newExitError(exitThresholdsBreached, "%d of %d threshold(s) breached", len(breached), len(report.Thresholds))
+	}
+	if report.Aborted != "" {
+		return newExitError(exitSessionsFailed, "run aborted by circuit breaker: %s", report.Aborted)
+	}
+	if n := results.Count(records, failOnReasons(failOn)...); n > 0 {
+		return newExitError(exitSessionsFailed, "%d of %d session(s) ended as %s", n, len(records), strings.Join(failOn, " or "))
+	}
+	return nil
+}
+
+// failOnReasons turns the validated --fail-on values into session outcomes,
+// where none means no outcome fails the run
+func failOnReasons(failOn []string) []results.Reason {
+	var reasons []results.Reason
+	for _, s := range failOn {
+		if s == failOnNone {
+			return nil
+		}
+		reasons = append(reasons, results.Reason(s))
+	}
+	return reasons
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/dpastoor/plr/internal/results"
+	"github.com/dpastoor/plr/internal/runner"
+	"github.com/metrumresearchgroup/wrapt"
+)
+
+func TestRunExit(tt *testing.T) {
+	defaultFailOn := []string{string(results.Failed), string(results.TimedOut)}
+	breached := []results.ThresholdResult{{Threshold: "error_rate<1%", Actual: "50%"}}
+	passed := []results.ThresholdResult{{Threshold: "error_rate<1%", Actual: "0%", Passed: true}}
+	records := func(reasons ...results.Reason) []results.Record {
+		var rs []results.Record
+		for i, reason := range reasons {
+			rs = append(rs, results.Record{Session: i + 1, Reason: reason})
+		}
+		return rs
+	}
+	tests := []struct {
+		name     string
+		sig      os.Signal
+		report   results.Report
+		records  []results.Record
+		failOn   []string
+		wantCode int
+		wantErr  string
+	}{
+		{
+			name:    "passed",
+			report:  results.Report{Thresholds: passed},
+			records: records(results.Completed, results.Stopped),
+			failOn:  defaultFailOn,
+		},
+		{
+			name:     "interrupted over everything else",
+			sig:      os.Interrupt,
+			report:   results.Report{Thresholds: breached, Aborted: "too many failures"},
+			records:  records(results.Failed),
+			failOn:   defaultFailOn,
+			wantCode: exitInterrupted,
+			wantErr:  "run interrupted by interrupt",
+		},
+		{
+			name:     "thresholds over circuit breaker",
+			report:   results.Report{Thresholds: append(breached, passed...), Aborted: "too many failures"},
+			records:  records(results.Failed),
+			failOn:   defaultFailOn,
+			wantCode: exitThresholdsBreached,
+			wantErr:  "1 of 2 threshold(s) breached",
+		},
+		{
+			name:     "circuit breaker over fail-on",
+			report:   results.Report{Aborted: "too many failures"},
+			records:  records(results.Failed),
+			failOn:   []string{failOnNone},
+			wantCode: exitSessionsFailed,
+			wantErr:  "run aborted by circuit breaker: too many failures",
+		},
+		{
+			name:     "failed session",
+			records:  records(results.Completed, results.Failed),
+			failOn:   defaultFailOn,
+			wantCode: exitSessionsFailed,
+			wantErr:  "1 of 2 session(s) ended as failed or timeout",
+		},
+		{
+			name:     "timed out session",
+			records:  records(results.TimedOut, results.TimedOut),
+			failOn:   defaultFailOn,
+			wantCode: exitSessionsFailed,
+			wantErr:  "2 of 2 session(s) ended as failed or timeout",
+		},
+		{
+			name:    "outcome left out of fail-on",
+			records: records(results.TimedOut),
+			failOn:  []string{string(results.Failed)},
+		},
+		{
+			name:    "fail-on none",
+			records: records(results.Failed, results.TimedOut, results.Killed),
+			failOn:  []string{failOnNone},
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+			err := runExit(test.sig, test.report, test.records, test.failOn)
+			if test.wantCode == 0 {
+				t.R.NoError(err)
+				return
+			}
+			var exitErr *exitError
+			t.R.ErrorAs(err, &exitErr)
+			t.A.Equal(test.wantCode, exitErr.code)
+			t.A.EqualError(err, test.wantErr)
+		})
+	}
+}
+
+func TestTerminationReason(tt *testing.T) {
+	tests := []struct {
+		err  error
+		want results.Reason
+	}{
+		{err: nil, want: results.Completed},
+		{err: fmt.Errorf("%w after session timeout of 1s", runner.ErrTimeout), want: results.TimedOut},
+		{err: fmt.Errorf("%w at run deadline", runner.ErrTimeout), want: results.TimedOut},
+		{err: runner.ErrKilled, want: results.Killed},
+		{err: context.Canceled, want: results.Stopped},
+		{err: errors.New("exit status 1"), want: results.Failed},
+	}
+	for _, test := range tests {
+		tt.Run(string(test.want), func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+			t.A.Equal(test.want, terminationReason(test.err))
+		})
+	}
+}
@@ -1,12 +1,16 @@
 package cmd
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"io"
 	"os"
 	"strings"
 
+	"github.com/dpastoor/plr/internal/config"
+	"github.com/dpastoor/plr/internal/redact"
+
 	log "github.com/sirupsen/logrus"
 )
 
@@ -39,11 +43,24 @@ func setLogLevel(level string) {
 	}
 }
 
+// prettyEncode writes data as indented json with any secrets masked
 func prettyEncode(data interface{}, out io.Writer) error {
-	enc := json.NewEncoder(out)
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
 	enc.SetIndent("", "    ")
 	if err := enc.Encode(data); err != nil {
 		return err
 	}
-	return nil
+	_, err := out.Write(redact.Bytes(buf.Bytes()))
+	return err
+}
+
+// readScenarios reads the scenarios and registers all of their
+// secrets for redaction, so every command should read scenarios through it
+func readScenarios(path string) (config.Scenarios, error) {
+	scenarios, err := config.Read(path)
+	// register even on error as the failure may be reported
+	// alongside the already resolved passwords
+	redact.Add(scenarios.Secrets()...)
+	return scenarios, err
 }
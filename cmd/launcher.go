@@ -0,0 +1,333 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dpastoor/plr/internal/config"
+	"github.com/dpastoor/plr/internal/output"
+	"github.com/dpastoor/plr/internal/redact"
+	"github.com/dpastoor/plr/internal/results"
+	"github.com/dpastoor/plr/internal/runner"
+	"github.com/samber/lo"
+	log "github.com/sirupsen/logrus"
+)
+
+// plannedSession is a session from the scenarios that was selected to run
+type plannedSession struct {
+	// num is the 1-indexed position of the session in the scenarios
+	num     int
+	session config.Session
+}
+
+// launcher launches sessions and keeps track of those in flight
+type launcher struct {
+	// ctx bounds waiting to launch, runCtx bounds running sessions
+	ctx    context.Context
+	runCtx context.Context
+	// force is closed when running sessions should be killed without waiting
+	force   <-chan struct{}
+	runOpts runOpts
+	url     string
+	// users maps user names to passwords
+	users map[string]string
+	// sessions take a slot before launching and give it back when done,
+	// a nil channel means there is no limit on concurrent sessions
+	slots chan struct{}
+	wg    sync.WaitGroup
+	// inFlight counts sessions that have been launched but not finished,
+	// including those still waiting on their delay or a slot
+	inFlight int64
+	// results collects the record of every session, whether it ran or not
+	results *results.Collector
+
+	// breaker, if set, aborts the run through stopRunning once too many sessions fail
+	breaker     *results.Breaker
+	stopRunning context.CancelFunc
+
+	mu sync.Mutex
+	// skipped are sessions that were queued but never started
+	skipped []plannedSession
+	// abortReason is why the circuit breaker aborted the run, if it did
+	abortReason string
+	// launches counts how often each session has launched, by session number
+	launches map[int]int
+	// failStreak counts the sessions that failed since the last one completed
+	failStreak int
+	// mux prefixes and interleaves the output of sessions for output.ModePrefixed
+	mux *output.Mux
+	// status is where the status line of each session is printed when there is no mux
+	status io.Writer
+}
+
+func newLauncher(ctx context.Context, runCtx context.Context, force <-chan struct{}, runOpts runOpts, url string, scenarios config.Scenarios, maxConcurrent int) *launcher {
+	l := &launcher{
+		ctx:      ctx,
+		runCtx:   runCtx,
+		force:    force,
+		runOpts:  runOpts,
+		url:      url,
+		users:    make(map[string]string, len(scenarios.Users)),
+		results:  results.NewCollector(),
+		launches: make(map[int]int),
+		// status lines bypass logrus, so need masking of their own
+		status: redact.Writer(os.Stdout),
+	}
+	for _, user := range scenarios.Users {
+		l.users[user.Name] = user.Password
+	}
+	if runOpts.output == output.ModePrefixed {
+		// the color setting was checked when validating the options
+		color, _ := output.UseColor(runOpts.color, os.Stdout)
+		l.mux = output.NewMux(os.Stdout, color)
+	}
+	if maxConcurrent > 0 {
+		log.Infof("running at most %d sessions at once", maxConcurrent)
+		l.slots = make(chan struct{}, maxConcurrent)
+	}
+	return l
+}
+
+// active returns the number of sessions in flight
+func (l *launcher) active() int {
+	return int(atomic.LoadInt64(&l.inFlight))
+}
+
+// notStarted returns the sessions that were queued but never started, by session number
+func (l *launcher) notStarted() []plannedSession {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	skipped := append([]plannedSession(nil), l.skipped...)
+	sort.Slice(skipped, func(i, j int) bool { return skipped[i].num < skipped[j].num })
+	return skipped
+}
+
+func (l *launcher) skip(p plannedSession) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.skipped = append(l.skipped, p)
+}
+
+// abortOn aborts the run by calling stopRunning once the breaker trips
+func (l *launcher) abortOn(breaker *results.Breaker, stopRunning context.CancelFunc) {
+	l.breaker = breaker
+	l.stopRunning = stopRunning
+}
+
+// aborted returns why the circuit breaker aborted the run, or "" if it did not
+func (l *launcher) aborted() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.abortReason
+}
+
+// finish adds the record of a session to the results and to the circuit breaker
+func (l *launcher) finish(record results.Record) {
+	reason := l.aborted()
+	if reason != "" && (record.Reason == results.Stopped || record.Reason == results.NotStarted) {
+		record.Error = "run aborted: " + reason
+	}
+	l.results.Add(record)
+	l.mu.Lock()
+	switch record.Reason {
+	case results.Failed:
+		l.failStreak++
+	case results.Completed:
+		l.failStreak = 0
+	}
+	l.mu.Unlock()
+	if record.Reason != results.NotStarted {
+		if l.mux != nil {
+			l.mux.Println(statusLine(record))
+		} else {
+			fmt.Fprintln(l.status, statusLine(record))
+		}
+	}
+	if l.breaker == nil {
+		return
+	}
+	if reason := l.breaker.Observe(record.Reason); reason != "" {
+		log.Errorf("aborting run: %s", reason)
+		l.mu.Lock()
+		l.abortReason = reason
+		l.mu.Unlock()
+		l.stopRunning()
+	}
+}
+
+// failures returns how many sessions failed in a row since the last one completed
+func (l *launcher) failures() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.failStreak
+}
+
+// wait blocks until every launched session is done
+func (l *launcher) wait() {
+	l.wg.Wait()
+}
+
+// launch runs the session in the background once delay has passed and a slot is free
+func (l *launcher) launch(p plannedSession, delay time.Duration) {
+	l.wg.Add(1)
+	atomic.AddInt64(&l.inFlight, 1)
+	go func() {
+		defer l.wg.Done()
+		defer atomic.AddInt64(&l.inFlight, -1)
+		l.run(p, delay)
+	}()
+}
+
+func (l *launcher) run(p plannedSession, delay time.Duration) {
+	num, s := p.num, p.session
+	record := results.Record{
+		Session:      num,
+		User:         s.User,
+		SessionName:  lo.FromPtr(s.Name),
+		Script:       l.runOpts.scriptPath,
+		PlannedDelay: delay.Seconds(),
+		Reason:       results.NotStarted,
+	}
+	defer func() { l.finish(record) }()
+	startTime := time.Now()
+	log.Infof("queued session %v for user: %s to launch in %.3f seconds", num, s.User, delay.Seconds())
+	select {
+	case <-l.ctx.Done():
+		log.Warnf("context done for session %d before starting", num)
+		l.skip(p)
+		return
+	case <-time.After(delay):
+	}
+	var slotWait time.Duration
+	if l.slots != nil {
+		queuedAt := time.Now()
+		select {
+		case l.slots <- struct{}{}:
+			defer func() { <-l.slots }()
+		case <-l.ctx.Done():
+			log.Warnf("context done for session %d while waiting %.3f seconds for a slot", num, time.Since(queuedAt).Seconds())
+			record.SlotWait = time.Since(queuedAt).Seconds()
+			l.skip(p)
+			return
+		}
+		slotWait = time.Since(queuedAt)
+	}
+	record.SlotWait = slotWait.Seconds()
+	log.Infof("launching session %v for user: %s after %.3f seconds since queued, waited %.3f seconds for a slot", num, s.User, time.Since(startTime).Seconds(), slotWait.Seconds())
+	opts := runner.NewOptsFromSession(s)
+	opts.Apply(runner.WithPythonPath(l.runOpts.python))
+	opts.Apply(runner.WithScriptContract(runner.ScriptContract(l.runOpts.scriptContract)))
+	opts.Apply(runner.WithPasswordDelivery(runner.PasswordDelivery(l.runOpts.passwordDelivery)))
+	opts.Apply(runner.WithKillGrace(l.runOpts.killGrace))
+	opts.Apply(runner.WithForceKill(l.force))
+	password, ok := l.users[s.User]
+	if !ok {
+		log.Errorf("could not look up password for user %s, not starting session %v", s.User, num)
+		record.Reason = results.Failed
+		record.Error = "could not look up password"
+		return
+	}
+	capture, err := output.NewCapture(filepath.Join(l.runOpts.runDir, output.SessionDir(num, s.User, l.nextLaunch(num))))
+	if err != nil {
+		log.Errorf("could not create output files for session %v: %s", num, err)
+		record.Reason = results.Failed
+		record.Error = fmt.Sprintf("could not create output files: %s", err)
+		return
+	}
+	defer capture.Close()
+	record.OutputDir = capture.Dir
+	opts.Apply(runner.WithNoIO())
+	stdout, stderr := io.Writer(capture.Stdout), io.Writer(capture.Stderr)
+	var prefixed []*output.LineWriter
+	switch l.runOpts.output {
+	case output.ModeLive:
+		opts.Apply(runner.WithStdin(os.Stdin))
+		stdout, stderr = io.MultiWriter(stdout, os.Stdout), io.MultiWriter(stderr, os.Stderr)
+	case output.ModePrefixed:
+		prefixedOut, prefixedErr := l.mux.Writer(num, s.User, "stdout"), l.mux.Writer(num, s.User, "stderr")
+		prefixed = append(prefixed, prefixedOut, prefixedErr)
+		stdout, stderr = io.MultiWriter(stdout, prefixedOut), io.MultiWriter(stderr, prefixedErr)
+	}
+	opts.Apply(runner.WithStdout(stdout))
+	opts.Apply(runner.WithStderr(stderr))
+	r := runner.NewRunner(l.runCtx, l.runOpts.scriptPath, l.url, s.User, password, s.RemoteCmdBase64, opts)
+	record.Launched(time.Now())
+	err = r.Run()
+	// Run only returns once the script's output is all written, so nothing
+	// else writes to the prefixed writers and their partial lines end up
+	// before the status line of the session
+	for _, w := range prefixed {
+		w.Flush()
+	}
+	record.Ended(time.Now(), r.ExitCode())
+	record.Leftovers = r.Leftovers()
+	record.Reason = terminationReason(err)
+	if err != nil {
+		record.Error = redact.String(err.Error())
+	}
+	switch record.Reason {
+	case results.Completed:
+		log.Infof("completed session %v for user: %s", num, s.User)
+	case results.TimedOut:
+		log.Warnf("session %v for user: %s %s", num, s.User, err)
+	case results.Killed, results.Stopped:
+		log.Warnf("session %v for user: %s was stopped: %s", num, s.User, err)
+	default:
+		log.Errorf("cmd failed to start session %v for user: %s with err %s", num, s.User, err)
+	}
+}
+
+// nextLaunch counts a launch of the session and returns which launch it is, starting from 1
+func (l *launcher) nextLaunch(num int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.launches[num]++
+	return l.launches[num]
+}
+
+// statusLine is the compact line printed for each session as it ends
+func statusLine(r results.Record) string {
+	exitCode := "-"
+	if r.ExitCode != nil {
+		exitCode = fmt.Sprint(*r.ExitCode)
+	}
+	line := fmt.Sprintf("[%s] session %d %s %.3fs exit=%s", r.Reason, r.Session, r.User, r.Duration, exitCode)
+	if r.OutputDir != "" {
+		line += " " + r.OutputDir
+	}
+	return line
+}
+
+// terminationReason classifies the error returned by running a session
+func terminationReason(err error) results.Reason {
+	switch {
+	case err == nil:
+		return results.Completed
+	case errors.Is(err, runner.ErrTimeout):
+		return results.TimedOut
+	case errors.Is(err, runner.ErrKilled):
+		return results.Killed
+	case errors.Is(err, context.Canceled):
+		return results.Stopped
+	default:
+		return results.Failed
+	}
+}
+
+// sessionDelay is how long after the start of the run the session should launch
+func sessionDelay(s config.Session) time.Duration {
+	delayMs := 5
+	if s.Delay != nil {
+		delayMs = int(math.Max(*s.Delay, 0)*1000) + 5
+	}
+	return time.Duration(delayMs) * time.Millisecond
+}
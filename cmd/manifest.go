@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/dpastoor/plr/internal/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// buildInfo describes the plr binary, as injected at build time
+type buildInfo struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	Date    string `json:"date"`
+}
+
+// fileInfo identifies an input file by path and content
+type fileInfo struct {
+	Path    string `json:"path"`
+	AbsPath string `json:"abs_path"`
+	SHA256  string `json:"sha256"`
+}
+
+type hostInfo struct {
+	Hostname  string `json:"hostname"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	NumCPU    int    `json:"num_cpu"`
+	GoVersion string `json:"go_version"`
+}
+
+// manifest records exactly what a run was started with,
+// and is written to manifest.json in the run directory
+type manifest struct {
+	Plr       buildInfo              `json:"plr"`
+	StartedAt time.Time              `json:"started_at"`
+	Script    fileInfo               `json:"script"`
+	Scenarios fileInfo               `json:"scenarios"`
+	Seed      int64                  `json:"seed"`
+	Flags     map[string]interface{} `json:"flags"`
+	Host      hostInfo               `json:"host"`
+}
+
+// effectiveFlags returns the value of every flag of cmd after
+// defaults, environment variables and the command line are applied
+func effectiveFlags(cmd *cobra.Command) map[string]interface{} {
+	flags := make(map[string]interface{})
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Name == "help" {
+			return
+		}
+		// flags bound to viper may also be set through the environment
+		if v := viper.Get(f.Name); v != nil {
+			flags[f.Name] = v
+			return
+		}
+		flags[f.Name] = f.Value.String()
+	})
+	return flags
+}
+
+func newFileInfo(path string) (fileInfo, error) {
+	info := fileInfo{Path: path}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return info, err
+	}
+	info.AbsPath = abs
+	f, err := os.Open(path)
+	if err != nil {
+		return info, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return info, err
+	}
+	info.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return info, nil
+}
+
+func newHostInfo() hostInfo {
+	hostname, _ := os.Hostname()
+	return hostInfo{
+		Hostname:  hostname,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		NumCPU:    runtime.NumCPU(),
+		GoVersion: runtime.Version(),
+	}
+}
+
+// writeManifest writes manifest.json and a copy of the resolved scenarios,
+// with secrets masked, to the run directory
+func writeManifest(runOpts runOpts, build buildInfo, seed int64, scenarios config.Scenarios, start time.Time) error {
+	m := manifest{
+		Plr:       build,
+		StartedAt: start,
+		Seed:      seed,
+		Flags:     runOpts.flags,
+		Host:      newHostInfo(),
+	}
+	var err error
+	if m.Script, err = newFileInfo(runOpts.scriptPath); err != nil {
+		return err
+	}
+	if m.Scenarios, err = newFileInfo(runOpts.scenariosPath); err != nil {
+		return err
+	}
+	if err := writeJSONFile(filepath.Join(runOpts.runDir, "scenarios.json"), scenarios); err != nil {
+		return err
+	}
+	return writeJSONFile(filepath.Join(runOpts.runDir, "manifest.json"), m)
+}
+
+func writeJSONFile(path string, data interface{}) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := prettyEncode(data, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
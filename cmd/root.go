@@ -1,6 +1,10 @@
 package cmd
 
 import (
+	"errors"
+	"os"
+
+	"github.com/dpastoor/plr/internal/redact"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/spf13/cobra"
@@ -17,13 +21,18 @@ type rootCmd struct {
 	cfg *settings
 }
 
-func Execute(version string, args []string) {
-	newRootCmd(version).Execute(args)
+func Execute(version string, commit string, date string, args []string) {
+	newRootCmd(buildInfo{Version: version, Commit: commit, Date: date}).Execute(args)
 }
 
 func (cmd *rootCmd) Execute(args []string) {
 	cmd.cmd.SetArgs(args)
 	if err := cmd.cmd.Execute(); err != nil {
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			log.Error(exitErr)
+			os.Exit(exitErr.code)
+		}
 		// if get to this point and don't fatally log in the subcommand,
 		// the Usage help will be printed before the error,
 		// which may or may not be the desired behavior
@@ -35,7 +44,13 @@ func setGlobalSettings(cfg *settings) {
 	cfg.loglevel = viper.GetString("loglevel")
 	setLogLevel(cfg.loglevel)
 }
-func newRootCmd(version string) *rootCmd {
+
+func init() {
+	// every log line goes through the redacting formatter so secrets
+	// never end up in logs, no matter which log path they take
+	log.SetFormatter(redact.NewFormatter(&log.TextFormatter{}))
+}
+func newRootCmd(build buildInfo) *rootCmd {
 	root := &rootCmd{cfg: &settings{}}
 	cmd := &cobra.Command{
 		Use:   "plr",
@@ -49,7 +64,9 @@ func newRootCmd(version string) *rootCmd {
 			setGlobalSettings(root.cfg)
 		},
 	}
-	cmd.Version = version
+	cmd.Version = build.Version
+	// cobra writes errors directly rather than through logrus
+	cmd.SetErr(redact.Writer(os.Stderr))
 	// without this, the default version is like `cmd version <version>` so this
 	// will just print the version for simpler parsing
 	cmd.SetVersionTemplate(`{{printf "%s\n" .Version}}`)
@@ -57,7 +74,8 @@ func newRootCmd(version string) *rootCmd {
 	viper.BindPFlag("loglevel", cmd.PersistentFlags().Lookup("loglevel"))
 	cmd.AddCommand(newDebugCmd(root.cfg))
 	cmd.AddCommand(newManCmd().cmd)
-	cmd.AddCommand(newRunCmd().cmd)
+	cmd.AddCommand(newRunCmd(build).cmd)
+	cmd.AddCommand(newScenariosCmd().cmd)
 	root.cmd = cmd
 	return root
 }
@@ -2,24 +2,43 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
+	"math/rand"
 	"os"
-	"os/signal"
-	"sync"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/dpastoor/plr/internal/config"
+	"github.com/dpastoor/plr/internal/output"
+	"github.com/dpastoor/plr/internal/results"
 	"github.com/dpastoor/plr/internal/runner"
+	"github.com/dpastoor/plr/internal/schedule"
 	"github.com/samber/lo"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+// failOnNone is the --fail-on value for never failing the run because of session outcomes
+const failOnNone = "none"
+
+// profileTick is how often a load profile or soak checks whether more sessions should launch
+const profileTick = 100 * time.Millisecond
+
+// soakBackoff is how long a soak waits between launches while sessions are failing,
+// doubling with each further failure in a row up to maxSoakBackoff
+const (
+	soakBackoff    = time.Second
+	maxSoakBackoff = 30 * time.Second
+)
+
 type runCmd struct {
-	cmd  *cobra.Command
-	opts runOpts
+	cmd   *cobra.Command
+	opts  runOpts
+	build buildInfo
 }
 
 type runOpts struct {
@@ -30,10 +49,43 @@ type runOpts struct {
 	unique        bool
 	noDelay       bool
 	python        string
+	// scriptContract is the version of the script interface,
+	// 1 is only kept for scripts that still expect --password
+	scriptContract   int
+	passwordDelivery string
+	// maxConcurrent limits the number of sessions running at once,
+	// 0 falls back to the scenarios max_concurrent
+	maxConcurrent int
+	// seed for all random choices, 0 picks a new seed for every run
+	seed    int64
+	shuffle bool
+	// maxDuration bounds the whole run, sessions still running
+	// when it is up are stopped and recorded as timed out
+	maxDuration time.Duration
+	// killGrace is how long a session has to exit after SIGTERM before being killed
+	killGrace time.Duration
+	// shutdownGrace is how long running sessions have to finish after an interrupt
+	shutdownGrace time.Duration
+	// resultsPaths are files to write the session records to,
+	// the format of each is picked by its extension
+	resultsPaths []string
+	// summaryPath is a file to also write the end of run summary to
+	summaryPath string
+	// failOn are the session outcomes that make the run fail
+	failOn []string
+	// runsDir is where a timestamped directory is created for each run
+	runsDir string
+	// runDir is the directory created for this run, set when the run starts
+	runDir string
+	output output.Mode
+	// color is whether to colorize prefixed output, auto, always or never
+	color string
+	// flags are the effective values of every flag, recorded in the run manifest
+	flags map[string]interface{}
 }
 
-func newRun(runOpts runOpts) error {
-	scenarios, err := config.Read(runOpts.scenariosPath)
+func newRun(runOpts runOpts, build buildInfo) error {
+	scenarios, err := readScenarios(runOpts.scenariosPath)
 	url := runOpts.url
 	if url == "" {
 		url = scenarios.Url
@@ -41,82 +93,250 @@ func newRun(runOpts runOpts) error {
 	if err != nil {
 		return err
 	}
-	ctx, cancel := context.WithCancel(context.Background())
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	// defer func() {
-	// 	signal.Stop(c)
-	// 	cancel()
-	// }()
-	go func() {
-		select {
-		case <-c:
-			signal.Stop(c)
-			fmt.Println("canceling")
-			cancel()
-		case <-ctx.Done():
-			fmt.Println("registering ctx done")
-			return
+	start := time.Now()
+	runOpts.runDir, err = output.NewRunDir(runOpts.runsDir, start)
+	if err != nil {
+		return fmt.Errorf("could not create run directory: %w", err)
+	}
+	log.Infof("plr %s (commit %s, built %s) writing run to %s", build.Version, build.Commit, build.Date, runOpts.runDir)
+	seed := runOpts.seed
+	if seed == 0 {
+		seed = start.UnixNano()
+	}
+	if err := writeManifest(runOpts, build, seed, scenarios, start); err != nil {
+		return fmt.Errorf("could not write run manifest: %w", err)
+	}
+	// runCtx bounds running sessions while launchCtx bounds launching new ones,
+	// so a shutdown can stop launching while letting running sessions finish
+	var runCtx context.Context
+	var stopRunning context.CancelFunc
+	if runOpts.maxDuration > 0 {
+		log.Infof("stopping the run after %s", runOpts.maxDuration)
+		runCtx, stopRunning = context.WithTimeout(context.Background(), runOpts.maxDuration)
+	} else {
+		runCtx, stopRunning = context.WithCancel(context.Background())
+	}
+	defer stopRunning()
+	ctx, stopLaunching := context.WithCancel(runCtx)
+	defer stopLaunching()
+	shutdown := watchSignals(stopLaunching, stopRunning, runOpts.shutdownGrace)
+	defer shutdown.stop()
+	maxConcurrent := runOpts.maxConcurrent
+	if maxConcurrent == 0 {
+		maxConcurrent = scenarios.MaxConcurrent
+	}
+	log.Infof("using seed %d, rerun with --seed=%d to reproduce the random choices of this run", seed, seed)
+	rng := schedule.NewRand(seed)
+	l := newLauncher(ctx, runCtx, shutdown.force, runOpts, url, scenarios, maxConcurrent)
+	if scenarios.CircuitBreaker != nil {
+		l.abortOn(results.NewBreaker(*scenarios.CircuitBreaker), stopRunning)
+	}
+	pool := selectSessions(scenarios.Sessions, runOpts, rng)
+	arrival := config.Arrival{}
+	if scenarios.Arrival != nil {
+		arrival = *scenarios.Arrival
+	}
+	switch {
+	case scenarios.Soak != nil:
+		if err := dispatchSoak(ctx, *scenarios.Soak, pool, l, rng, stopRunning); err != nil {
+			return err
+		}
+	case scenarios.Profile != nil:
+		dispatchProfile(ctx, schedule.NewProfile(*scenarios.Profile), pool, l)
+	case arrival.Rate > 0:
+		log.Infof("launching sessions at an average of %.3f per second", arrival.Rate)
+		arrivals := schedule.PoissonArrivals(rng, len(pool), arrival.Rate)
+		for i, p := range pool {
+			l.launch(p, arrivals[i])
+		}
+	default:
+		jitter := time.Duration(arrival.Jitter * float64(time.Second))
+		for _, p := range pool {
+			delay := sessionDelay(p.session)
+			if !runOpts.noDelay {
+				delay = schedule.Jitter(rng, delay, jitter)
+			}
+			l.launch(p, delay)
 		}
-	}()
-	wg := &sync.WaitGroup{}
-	users := lo.SliceToMap(scenarios.Users, func(user config.User) (string, string) {
-		return user.Name, user.Password
-	})
-	hasRunForUser := make(map[string]bool)
-	for user := range users {
-		hasRunForUser[user] = false
 	}
-	//rand.Shuffle(len(sessions), func(i, j int) { sessions[i], sessions[j] = sessions[j], sessions[i] })
-	for i, session := range scenarios.Sessions {
+	l.wait()
+	log.Info("done waiting on sessions to finish/cleanup")
+	if notStarted := l.notStarted(); len(notStarted) > 0 {
+		log.Warnf("%d queued session(s) never started: %s", len(notStarted), strings.Join(lo.Map(notStarted, func(p plannedSession, _ int) string {
+			return fmt.Sprintf("%d (%s)", p.num, p.session.User)
+		}), ", "))
+	}
+	records := l.results.Records()
+	// the run directory always gets the results so it has everything about the run
+	for _, path := range append([]string{filepath.Join(runOpts.runDir, "results.jsonl")}, runOpts.resultsPaths...) {
+		if err := results.WriteFile(path, records); err != nil {
+			log.Errorf("could not write results: %s", err)
+			continue
+		}
+		log.Infof("wrote %d session result(s) to %s", len(records), path)
+	}
+	report := results.Summarize(records)
+	thresholds, err := scenarios.ParseThresholds()
+	if err != nil {
+		return err
+	}
+	report.Thresholds = results.EvaluateThresholds(thresholds, records)
+	report.Aborted = l.aborted()
+	if err := results.WriteTable(os.Stdout, report); err != nil {
+		log.Errorf("could not print summary: %s", err)
+	}
+	summaryPaths := []string{filepath.Join(runOpts.runDir, "summary.json")}
+	if runOpts.summaryPath != "" {
+		summaryPaths = append(summaryPaths, runOpts.summaryPath)
+	}
+	for _, path := range summaryPaths {
+		if err := results.WriteReportFile(path, report); err != nil {
+			log.Errorf("could not write summary: %s", err)
+		}
+	}
+	if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		log.Warnf("run stopped at max duration of %s", runOpts.maxDuration)
+	}
+	for _, t := range results.Breached(report.Thresholds) {
+		log.Errorf("threshold %s breached, actual value %s", t.Threshold, lo.Ternary(t.Actual == "", "could not be measured", t.Actual))
+	}
+	return runExit(shutdown.interrupted(), report, records, runOpts.failOn)
+}
+
+// selectSessions picks the sessions to run, honoring shuffle, num-sessions, unique and no-delay.
+// Shuffling happens first so num-sessions and unique pick from the shuffled order,
+// while each session keeps the number of its position in the scenarios
+func selectSessions(sessions []config.Session, runOpts runOpts, rng *rand.Rand) []plannedSession {
+	candidates := make([]plannedSession, len(sessions))
+	for i, session := range sessions {
+		candidates[i] = plannedSession{num: i + 1, session: session}
+	}
+	if runOpts.shuffle {
+		rng.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	}
+	var pool []plannedSession
+	hasRunForUser := make(map[string]bool)
+	for i, candidate := range candidates {
 		if runOpts.noDelay {
-			session.Delay = nil
+			candidate.session.Delay = nil
 		}
 		if i >= runOpts.numSessions {
 			continue
 		}
 		if runOpts.unique {
-			if hasRunForUser[session.User] {
+			if hasRunForUser[candidate.session.User] {
 				continue
 			}
-			hasRunForUser[session.User] = true
+			hasRunForUser[candidate.session.User] = true
 		}
-		wg.Add(1)
-		var delayMs int
-		if session.Delay == nil {
-			delayMs = 5
-		} else {
-			delayMs = int(math.Max(*session.Delay, 0)*1000) + 5
-		}
-		go func(wg *sync.WaitGroup, s config.Session, num int) {
-			startTime := time.Now()
-			log.Infof("queued session %v for user: %s after %.3f seconds since start\n", num, s.User, time.Since(startTime).Seconds())
-			defer wg.Done()
-			select {
-			case <-ctx.Done():
-				log.Warnf("context done for session %d before starting", num)
-				return
-			case <-time.Tick(time.Duration(delayMs) * time.Millisecond):
-				log.Printf("launching session %v for user: %s after %.3f seconds since start\n", num, s.User, time.Since(startTime).Seconds())
-				opts := runner.NewOptsFromSession(s)
-				opts.Apply(runner.WithPythonPath(runOpts.python))
-				password, ok := users[s.User]
-				if !ok {
-					log.Errorf("could not look up password for user %s, not starting session %v", s.User, num)
-					return
-				}
-				runner := runner.NewRunner(ctx, runOpts.scriptPath, url, s.User, password, s.RemoteCmdBase64, opts)
-				if err := runner.Run(); err != nil {
-					log.Errorf("cmd failed to start session %v for user: %s with err %s\n", num, s.User, err)
-					return
-				}
-				log.Infof("completed session %v for user: %s\n", num, s.User)
+		pool = append(pool, candidate)
+	}
+	return pool
+}
+
+// dispatchProfile launches sessions from the pool whenever fewer sessions are
+// in flight than the profile targets, until the profile ends or the pool runs out.
+// Session delays are not used as the profile decides when sessions launch
+func dispatchProfile(ctx context.Context, profile schedule.Profile, pool []plannedSession, l *launcher) {
+	log.Infof("following load profile of %d stage(s) over %s", len(profile), profile.Duration())
+	start := time.Now()
+	ticker := time.NewTicker(profileTick)
+	defer ticker.Stop()
+	next := 0
+	for next < len(pool) {
+		elapsed := time.Since(start)
+		if elapsed >= profile.Duration() {
+			break
+		}
+		for next < len(pool) && l.active() < profile.Target(elapsed) {
+			l.launch(pool[next], 0)
+			next++
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+	if next < len(pool) {
+		log.Warnf("load profile ended with %d session(s) not launched", len(pool)-next)
+	}
+}
+
+// dispatchSoak keeps soak.Concurrent sessions in flight for soak.Duration,
+// relaunching sessions from the pool as running ones finish.
+// While sessions are failing, launches are spaced out by a growing backoff
+// rather than replacing each failed session right away.
+// Once the duration is up no more sessions are launched, and those still
+// running get the shutdown grace period to finish before they are stopped
+// through stopRunning, so a hung session can not keep the soak going
+func dispatchSoak(ctx context.Context, soak config.Soak, pool []plannedSession, l *launcher, rng *rand.Rand, stopRunning context.CancelFunc) error {
+	if len(pool) == 0 {
+		return nil
+	}
+	var picker schedule.Picker
+	if soak.Selection == config.SoakWeighted {
+		weights := lo.Map(pool, func(p plannedSession, _ int) float64 {
+			if p.session.Weight == nil {
+				return 1
 			}
-		}(wg, session, i+1)
+			return *p.session.Weight
+		})
+		var err error
+		picker, err = schedule.NewWeighted(rng, weights)
+		if err != nil {
+			return fmt.Errorf("could not set up weighted soak: %w", err)
+		}
+	} else {
+		picker = schedule.NewRoundRobin(len(pool))
+	}
+	duration := time.Duration(soak.Duration * float64(time.Second))
+	log.Infof("soaking with %d concurrent session(s) for %s", soak.Concurrent, duration)
+	deadline := time.NewTimer(duration)
+	defer deadline.Stop()
+	ticker := time.NewTicker(profileTick)
+	defer ticker.Stop()
+	launched := 0
+	var holdUntil time.Time
+	for {
+		for l.active() < soak.Concurrent && !time.Now().Before(holdUntil) {
+			l.launch(pool[picker.Next()], 0)
+			launched++
+			if failures := l.failures(); failures > 0 {
+				backoff := relaunchBackoff(failures)
+				log.Warnf("%d session(s) failed in a row, waiting %s before the next launch", failures, backoff)
+				holdUntil = time.Now().Add(backoff)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-deadline.C:
+			grace := l.runOpts.shutdownGrace
+			log.Infof("soak duration of %s is up after %d launch(es), giving %d running session(s) %s to finish", duration, launched, l.active(), grace)
+			go func() {
+				timer := time.NewTimer(grace)
+				defer timer.Stop()
+				select {
+				case <-l.runCtx.Done():
+				case <-timer.C:
+					log.Warnf("soak grace period of %s is up, stopping %d running session(s)", grace, l.active())
+					stopRunning()
+				}
+			}()
+			return nil
+		case <-ticker.C:
+		}
 	}
-	wg.Wait()
-	log.Info("done waiting on sessions to finish/cleanup")
-	return ctx.Err()
+}
+
+// relaunchBackoff is how long to wait between launches after failures sessions failed in a row
+func relaunchBackoff(failures int) time.Duration {
+	backoff := soakBackoff
+	for i := 1; i < failures && backoff < maxSoakBackoff; i++ {
+		backoff *= 2
+	}
+	return lo.Min([]time.Duration{backoff, maxSoakBackoff})
 }
 
 func setRunOpts(runOpts *runOpts, args []string) {
@@ -135,6 +355,20 @@ func setRunOpts(runOpts *runOpts, args []string) {
 	runOpts.unique = viper.GetBool("unique")
 	runOpts.noDelay = viper.GetBool("no-delay")
 	runOpts.python = viper.GetString("python")
+	runOpts.scriptContract = viper.GetInt("script-contract")
+	runOpts.passwordDelivery = viper.GetString("password-from")
+	runOpts.maxConcurrent = viper.GetInt("max-concurrent")
+	runOpts.seed = viper.GetInt64("seed")
+	runOpts.shuffle = viper.GetBool("shuffle")
+	runOpts.maxDuration = viper.GetDuration("max-duration")
+	runOpts.killGrace = viper.GetDuration("kill-grace")
+	runOpts.shutdownGrace = viper.GetDuration("shutdown-grace")
+	runOpts.resultsPaths = viper.GetStringSlice("results")
+	runOpts.summaryPath = viper.GetString("summary")
+	runOpts.failOn = viper.GetStringSlice("fail-on")
+	runOpts.runsDir = viper.GetString("runs-dir")
+	runOpts.output = output.Mode(viper.GetString("output"))
+	runOpts.color = viper.GetString("color")
 }
 
 func (opts *runOpts) Validate() error {
@@ -147,11 +381,48 @@ func (opts *runOpts) Validate() error {
 		}
 
 	}
+	if opts.maxConcurrent < 0 {
+		return fmt.Errorf("max-concurrent must not be negative, got %d", opts.maxConcurrent)
+	}
+	if opts.maxDuration < 0 {
+		return fmt.Errorf("max-duration must not be negative, got %s", opts.maxDuration)
+	}
+	if opts.killGrace < 0 {
+		return fmt.Errorf("kill-grace must not be negative, got %s", opts.killGrace)
+	}
+	if opts.shutdownGrace < 0 {
+		return fmt.Errorf("shutdown-grace must not be negative, got %s", opts.shutdownGrace)
+	}
+	for _, path := range opts.resultsPaths {
+		if _, err := results.FormatFor(path); err != nil {
+			return err
+		}
+	}
+	for _, outcome := range opts.failOn {
+		if outcome == failOnNone {
+			continue
+		}
+		if _, err := results.ParseReason(outcome); err != nil {
+			return fmt.Errorf("invalid fail-on: %w", err)
+		}
+	}
+	if _, err := output.ParseMode(string(opts.output)); err != nil {
+		return err
+	}
+	if _, err := output.UseColor(opts.color, os.Stdout); err != nil {
+		return err
+	}
+	if _, err := runner.ParseScriptContract(opts.scriptContract); err != nil {
+		return err
+	}
+	if _, err := runner.ParsePasswordDelivery(opts.passwordDelivery); err != nil {
+		return err
+	}
 	return nil
 }
 
-func newRunCmd() *runCmd {
-	root := &runCmd{opts: runOpts{}}
+func newRunCmd(build buildInfo) *runCmd {
+	root := &runCmd{opts: runOpts{}, build: build}
 
 	cmd := &cobra.Command{
 		Use:   "run",
@@ -163,16 +434,25 @@ func newRunCmd() *runCmd {
 			}
 			return nil
 		},
-		RunE: func(_ *cobra.Command, args []string) error {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			//TODO: Add your logic to gather config to pass code here
 			log.WithField("opts", fmt.Sprintf("%+v", root.opts)).Trace("run-opts")
-			if err := newRun(root.opts); err != nil {
-				log.Fatalf("failed to complete all runs with err: %s", err)
+			// the run has started so errors are about the run rather than how plr was called,
+			// and are logged when exiting with the matching exit code
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+			root.opts.flags = effectiveFlags(cmd)
+			if err := newRun(root.opts, root.build); err != nil {
+				var exitErr *exitError
+				if errors.As(err, &exitErr) {
+					return err
+				}
+				return fmt.Errorf("failed to complete all runs with err: %w", err)
 			}
 			return nil
 		},
 	}
-	cmd.Flags().String("scenarios-path", "scenarios.json", "path to scenarios file")
+	cmd.Flags().String("scenarios-path", "scenarios.json", "path to scenarios file (.json, .yaml, .yml or .toml)")
 	viper.BindPFlag("scenarios-path", cmd.Flags().Lookup("scenarios-path"))
 	cmd.Flags().IntP("num-sessions", "n", 0, "number of sessions to run")
 	viper.BindPFlag("num-sessions", cmd.Flags().Lookup("num-sessions"))
@@ -182,6 +462,34 @@ func newRunCmd() *runCmd {
 	viper.BindPFlag("unique", cmd.Flags().Lookup("unique"))
 	cmd.Flags().Bool("no-delay", false, "start immediately instead of waiting for delay")
 	viper.BindPFlag("no-delay", cmd.Flags().Lookup("no-delay"))
+	cmd.Flags().Int("max-concurrent", 0, "maximum number of sessions running at once, overrides the scenarios max_concurrent (0 for the scenarios value)")
+	viper.BindPFlag("max-concurrent", cmd.Flags().Lookup("max-concurrent"))
+	cmd.Flags().Duration("max-duration", 0, "maximum duration of the whole run, after which running sessions are stopped and recorded as timed out, failing the run unless --fail-on leaves out timeout (0 for no limit)")
+	viper.BindPFlag("max-duration", cmd.Flags().Lookup("max-duration"))
+	cmd.Flags().Duration("kill-grace", runner.DefaultKillGrace, "how long a stopped session has to exit after SIGTERM before it is killed")
+	viper.BindPFlag("kill-grace", cmd.Flags().Lookup("kill-grace"))
+	cmd.Flags().Duration("shutdown-grace", time.Minute, "how long running sessions have to finish after SIGINT/SIGTERM or the end of a soak before they are stopped, a second signal kills them immediately")
+	viper.BindPFlag("shutdown-grace", cmd.Flags().Lookup("shutdown-grace"))
+	cmd.Flags().StringSlice("results", nil, "files to write a record of every session to, as JSON Lines (.jsonl or .ndjson) or CSV (.csv), can be repeated")
+	viper.BindPFlag("results", cmd.Flags().Lookup("results"))
+	cmd.Flags().String("summary", "", "file to also write the end of run summary to, as json if it ends in .json and as a table otherwise")
+	viper.BindPFlag("summary", cmd.Flags().Lookup("summary"))
+	cmd.Flags().StringSlice("fail-on", []string{string(results.Failed), string(results.TimedOut)}, fmt.Sprintf("session outcomes that make plr exit with %d, any of %v or none", exitSessionsFailed, results.Reasons))
+	viper.BindPFlag("fail-on", cmd.Flags().Lookup("fail-on"))
+	cmd.Flags().String("runs-dir", "plr-runs", "directory to create a timestamped directory in for each run, holding its manifest, results and the output of every session")
+	viper.BindPFlag("runs-dir", cmd.Flags().Lookup("runs-dir"))
+	cmd.Flags().String("output", string(output.ModeCapture), "how session output reaches the terminal, capture to only show a status line per session, live to also pass the output through or prefixed to pass it through with every line prefixed by the session, user and stream")
+	viper.BindPFlag("output", cmd.Flags().Lookup("output"))
+	cmd.Flags().String("color", output.ColorAuto, "colorize prefixed output, auto (when writing to a terminal and NO_COLOR is not set), always or never")
+	viper.BindPFlag("color", cmd.Flags().Lookup("color"))
+	cmd.Flags().Int64("seed", 0, "seed for random arrivals, jitter and shuffling, 0 picks a new seed that is logged for reproducing the run")
+	viper.BindPFlag("seed", cmd.Flags().Lookup("seed"))
+	cmd.Flags().Bool("shuffle", false, "shuffle the order of sessions before selecting which to run")
+	viper.BindPFlag("shuffle", cmd.Flags().Lookup("shuffle"))
+	cmd.Flags().Int("script-contract", int(runner.ContractV2), "script contract version, use 1 for scripts that expect --password on the command line")
+	viper.BindPFlag("script-contract", cmd.Flags().Lookup("script-contract"))
+	cmd.Flags().String("password-from", string(runner.PasswordFromEnv), "how to hand the password to the script for contract version 2 (env or stdin)")
+	viper.BindPFlag("password-from", cmd.Flags().Lookup("password-from"))
 
 	cmd.Flags().String("python", "python", "path to python executable")
 	viper.BindPFlag("python", cmd.Flags().Lookup("python"))
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/dpastoor/plr/internal/config"
+	"github.com/dpastoor/plr/internal/redact"
+	"github.com/spf13/cobra"
+)
+
+type scenariosCmd struct {
+	cmd *cobra.Command
+}
+
+// scenariosPathFromArgs returns the scenarios file given as the only
+// argument, falling back to the same default as the run command
+func scenariosPathFromArgs(args []string) string {
+	if len(args) == 0 {
+		return "scenarios.json"
+	}
+	return args[0]
+}
+
+func newScenariosExpandCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "expand [path/to/scenarios]",
+		Short: "print the fully expanded list of sessions",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			scenarios, err := readScenarios(scenariosPathFromArgs(args))
+			if err != nil {
+				return err
+			}
+			return prettyEncode(scenarios.Sessions, os.Stdout)
+		},
+	}
+}
+
+// scenariosValidation is the machine readable result of validating a scenarios file
+type scenariosValidation struct {
+	Path   string                  `json:"path"`
+	Valid  bool                    `json:"valid"`
+	Errors config.ValidationErrors `json:"errors"`
+}
+
+func validateScenarios(path string) scenariosValidation {
+	result := scenariosValidation{Path: path, Errors: config.ValidationErrors{}}
+	_, err := readScenarios(path)
+	var validationErrs config.ValidationErrors
+	switch {
+	case err == nil:
+	case errors.As(err, &validationErrs):
+		result.Errors = validationErrs
+	default:
+		// the file could not be loaded far enough to validate
+		result.Errors = config.ValidationErrors{{Message: err.Error()}}
+	}
+	result.Valid = len(result.Errors) == 0
+	return result
+}
+
+func newScenariosValidateCmd() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "validate [path/to/scenarios]",
+		Short: "report every problem in a scenarios file",
+		// an invalid file is an expected outcome rather than a usage problem
+		SilenceUsage: true,
+		Args:         cobra.MaximumNArgs(1),
+		PreRunE: func(_ *cobra.Command, _ []string) error {
+			if output != "text" && output != "json" {
+				return fmt.Errorf("unknown output %q, must be text or json", output)
+			}
+			return nil
+		},
+		RunE: func(_ *cobra.Command, args []string) error {
+			result := validateScenarios(scenariosPathFromArgs(args))
+			if output == "json" {
+				if err := prettyEncode(result, os.Stdout); err != nil {
+					return err
+				}
+			} else {
+				for _, err := range result.Errors {
+					fmt.Println(redact.String(err.Error()))
+				}
+			}
+			if !result.Valid {
+				return fmt.Errorf("%s has %d problem(s)", result.Path, len(result.Errors))
+			}
+			if output == "text" {
+				fmt.Printf("%s is valid\n", result.Path)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "output format (text or json)")
+	return cmd
+}
+
+func newScenariosSchemaCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "schema",
+		Short: "print the JSON Schema for scenarios files",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return prettyEncode(config.Schema(), os.Stdout)
+		},
+	}
+}
+
+func newScenariosCmd() *scenariosCmd {
+	root := &scenariosCmd{}
+	cmd := &cobra.Command{
+		Use:   "scenarios",
+		Short: "inspect scenarios files",
+	}
+	cmd.AddCommand(newScenariosExpandCmd())
+	cmd.AddCommand(newScenariosValidateCmd())
+	cmd.AddCommand(newScenariosSchemaCmd())
+	root.cmd = cmd
+	return root
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// shutdown handles SIGINT and SIGTERM in two stages.
+// The first signal stops new sessions from launching and gives running
+// sessions the grace period to finish before they are asked to stop.
+// A second signal kills every running session straight away
+type shutdown struct {
+	stopLaunching context.CancelFunc
+	stopRunning   context.CancelFunc
+	grace         time.Duration
+	// force is closed on the second signal
+	force   chan struct{}
+	signals chan os.Signal
+	done    chan struct{}
+
+	mu       sync.Mutex
+	received os.Signal
+}
+
+func watchSignals(stopLaunching, stopRunning context.CancelFunc, grace time.Duration) *shutdown {
+	s := &shutdown{
+		stopLaunching: stopLaunching,
+		stopRunning:   stopRunning,
+		grace:         grace,
+		force:         make(chan struct{}),
+		signals:       make(chan os.Signal, 2),
+		done:          make(chan struct{}),
+	}
+	signal.Notify(s.signals, os.Interrupt, syscall.SIGTERM)
+	go s.loop()
+	return s
+}
+
+func (s *shutdown) loop() {
+	var sig os.Signal
+	select {
+	case sig = <-s.signals:
+	case <-s.done:
+		return
+	}
+	s.mu.Lock()
+	s.received = sig
+	s.mu.Unlock()
+	log.Warnf("received %s, no longer launching sessions and giving running sessions %s to finish, send again to kill them now", sig, s.grace)
+	s.stopLaunching()
+	grace := time.NewTimer(s.grace)
+	defer grace.Stop()
+	select {
+	case sig = <-s.signals:
+		log.Errorf("received second %s, killing all running sessions", sig)
+		close(s.force)
+		s.stopRunning()
+	case <-grace.C:
+		log.Warnf("shutdown grace period of %s is up, stopping running sessions", s.grace)
+		s.stopRunning()
+	case <-s.done:
+	}
+}
+
+// stop stops listening for signals
+func (s *shutdown) stop() {
+	signal.Stop(s.signals)
+	close(s.done)
+}
+
+// interrupted returns the first signal received, or nil if there was none
+func (s *shutdown) interrupted() os.Signal {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.received
+}
@@ -0,0 +1,28 @@
+package config
+
+import "fmt"
+
+// CircuitBreaker aborts the run once too many of the most recent sessions
+// failed or timed out, such as when the server has fallen over
+type CircuitBreaker struct {
+	Window          int     `json:"window" yaml:"window" toml:"window" desc:"number of most recent session outcomes to watch"`
+	MaxFailures     int     `json:"max_failures,omitempty" yaml:"max_failures,omitempty" toml:"max_failures,omitempty" desc:"abort once this many sessions in the window failed or timed out, 0 for no limit"`
+	MaxFailureRatio float64 `json:"max_failure_ratio,omitempty" yaml:"max_failure_ratio,omitempty" toml:"max_failure_ratio,omitempty" desc:"abort once this share of a full window failed or timed out, between 0 and 1, 0 for no limit"`
+}
+
+func (c CircuitBreaker) check() ValidationErrors {
+	var errs ValidationErrors
+	if c.Window <= 0 {
+		errs = append(errs, ValidationError{Message: "circuit_breaker window must be greater than 0"})
+	}
+	if c.MaxFailures < 0 || (c.Window > 0 && c.MaxFailures > c.Window) {
+		errs = append(errs, ValidationError{Message: fmt.Sprintf("circuit_breaker max_failures must be between 0 and the window of %d", c.Window)})
+	}
+	if c.MaxFailureRatio < 0 || c.MaxFailureRatio > 1 {
+		errs = append(errs, ValidationError{Message: "circuit_breaker max_failure_ratio must be between 0 and 1"})
+	}
+	if c.MaxFailures == 0 && c.MaxFailureRatio == 0 {
+		errs = append(errs, ValidationError{Message: "circuit_breaker must set max_failures or max_failure_ratio"})
+	}
+	return errs
+}
@@ -1,84 +1,174 @@
 package config
 
 import (
-	"encoding/json"
-	"errors"
 	"fmt"
 	"os"
-	"strings"
+	"path/filepath"
 
 	"github.com/samber/lo"
 )
 
 type Scenarios struct {
-	Users    []User    `json:"users"`
-	Sessions []Session `json:"sessions"`
-	Url      string    `json:"url"`
+	Users            []User            `json:"users" yaml:"users" toml:"users" desc:"users sessions can be run as"`
+	UsersFile        string            `json:"users_file,omitempty" yaml:"users_file,omitempty" toml:"users_file,omitempty" desc:"csv file, relative to the scenarios file, with a name column and one of the password columns; its users are added after users"`
+	Sessions         []Session         `json:"sessions" yaml:"sessions" toml:"sessions" desc:"sessions to run"`
+	SessionTemplates []SessionTemplate `json:"session_templates,omitempty" yaml:"session_templates,omitempty" toml:"session_templates,omitempty" desc:"templates expanded into sessions when the scenarios are read"`
+	Url              string            `json:"url" yaml:"url" toml:"url" desc:"url of the server, can be overridden with --url"`
+	Defaults         *SessionDefaults  `json:"defaults,omitempty" yaml:"defaults,omitempty" toml:"defaults,omitempty" desc:"defaults for every session, overridden by user defaults and then the session itself"`
+	MaxConcurrent    int               `json:"max_concurrent,omitempty" yaml:"max_concurrent,omitempty" toml:"max_concurrent,omitempty" desc:"maximum number of sessions running at once, 0 for no limit. Can be overridden with --max-concurrent"`
+	Profile          *Profile          `json:"profile,omitempty" yaml:"profile,omitempty" toml:"profile,omitempty" desc:"load profile used to pick launch times instead of each session's delay"`
+	Arrival          *Arrival          `json:"arrival,omitempty" yaml:"arrival,omitempty" toml:"arrival,omitempty" desc:"randomized arrival of sessions, a seed can be set with --seed to reproduce a run"`
+	Soak             *Soak             `json:"soak,omitempty" yaml:"soak,omitempty" toml:"soak,omitempty" desc:"keep a number of sessions running for a fixed duration instead of running each session once"`
+	CircuitBreaker   *CircuitBreaker   `json:"circuit_breaker,omitempty" yaml:"circuit_breaker,omitempty" toml:"circuit_breaker,omitempty" desc:"abort the run once too many recent sessions failed or timed out"`
+	Thresholds       []string          `json:"thresholds,omitempty" yaml:"thresholds,omitempty" toml:"thresholds,omitempty" desc:"checks on the whole run like p95_duration < 90s or error_rate < 2%, a breached threshold fails the run"`
 }
 
-// User defines a new User
+// User defines a new User.
+// The password can either be set directly or come from exactly one of
+// an environment variable, a file or the output of a command,
+// which are resolved into Password when the scenarios are read
 type User struct {
-	Name     string `json:"name"`
-	Password string `json:"password"`
+	Name         string            `json:"name" yaml:"name" toml:"name" desc:"name of the user"`
+	Password     string            `json:"password" yaml:"password" toml:"password" desc:"password for the user"`
+	PasswordEnv  string            `json:"password_env,omitempty" yaml:"password_env,omitempty" toml:"password_env,omitempty" desc:"environment variable to read the password from"`
+	PasswordFile string            `json:"password_file,omitempty" yaml:"password_file,omitempty" toml:"password_file,omitempty" desc:"file, relative to the scenarios file, to read the password from"`
+	PasswordCmd  string            `json:"password_cmd,omitempty" yaml:"password_cmd,omitempty" toml:"password_cmd,omitempty" desc:"shell command whose first line of output is the password"`
+	Attributes   map[string]string `json:"attributes,omitempty" yaml:"attributes,omitempty" toml:"attributes,omitempty" desc:"extra columns for users loaded from a users_file"`
+	Defaults     *SessionDefaults  `json:"defaults,omitempty" yaml:"defaults,omitempty" toml:"defaults,omitempty" desc:"defaults for every session of the user, overriding the scenarios defaults"`
+	// passwordErr records why the password could not be resolved
+	passwordErr error
 }
 
 // Session defines a new selenium session
 type Session struct {
-	User            string   `json:"user,omitempty"`
-	RemoteCmdBase64 string   `json:"remote_cmd_base64,omitempty"`
-	Name            *string  `json:"name,omitempty"`
-	Id              *string  `json:"id,omitempty"`
-	Headless        *bool    `json:"headless,omitempty"`
-	New             *bool    `json:"new,omitempty"`
-	Delay           *float64 `json:"delay,omitempty"`
-	Ncpu            *int     `json:"ncpu,omitempty"`
-	Memory          *int     `json:"memory,omitempty"`
-	Image           *string  `json:"image,omitempty"`
+	User            string   `json:"user,omitempty" yaml:"user,omitempty" toml:"user,omitempty" desc:"name of the user to run the session as"`
+	RemoteCmdBase64 string   `json:"remote_cmd_base64,omitempty" yaml:"remote_cmd_base64,omitempty" toml:"remote_cmd_base64,omitempty" desc:"base64 encoded command to run in the console"`
+	RemoteCmd       string   `json:"remote_cmd,omitempty" yaml:"remote_cmd,omitempty" toml:"remote_cmd,omitempty" desc:"command to run in the console, base64 encoded when read"`
+	RemoteCmdFile   string   `json:"remote_cmd_file,omitempty" yaml:"remote_cmd_file,omitempty" toml:"remote_cmd_file,omitempty" desc:"file, relative to the scenarios file, with the command to run in the console"`
+	Name            *string  `json:"name,omitempty" yaml:"name,omitempty" toml:"name,omitempty" desc:"name of the session, required to reuse an existing session"`
+	Id              *string  `json:"id,omitempty" yaml:"id,omitempty" toml:"id,omitempty" desc:"id of the session"`
+	Headless        *bool    `json:"headless,omitempty" yaml:"headless,omitempty" toml:"headless,omitempty" desc:"run the browser in headless mode, defaults to true"`
+	New             *bool    `json:"new,omitempty" yaml:"new,omitempty" toml:"new,omitempty" desc:"start a new session, defaults to true. Sessions that are not new must set a name"`
+	Delay           *float64 `json:"delay,omitempty" yaml:"delay,omitempty" toml:"delay,omitempty" desc:"seconds to wait after the run starts before launching the session"`
+	Ncpu            *int     `json:"ncpu,omitempty" yaml:"ncpu,omitempty" toml:"ncpu,omitempty" desc:"number of cpus to request for the session"`
+	Memory          *int     `json:"memory,omitempty" yaml:"memory,omitempty" toml:"memory,omitempty" desc:"memory to request for the session"`
+	Image           *string  `json:"image,omitempty" yaml:"image,omitempty" toml:"image,omitempty" desc:"image to use for the session"`
+	Timeout         *float64 `json:"timeout,omitempty" yaml:"timeout,omitempty" toml:"timeout,omitempty" desc:"seconds the session may run before it is stopped and recorded as timed out"`
+	Weight          *float64 `json:"weight,omitempty" yaml:"weight,omitempty" toml:"weight,omitempty" desc:"relative chance of the session being picked in a weighted soak, defaults to 1"`
 }
 
+// Validate returns ValidationErrors with every problem in
+// the scenarios, or nil if there are none
 func (cfg Scenarios) Validate() error {
-	for _, user := range cfg.Users {
-		if user.Name == "" || user.Password == "" {
-			return errors.New("must set user name and password for all users")
+	if errs := cfg.Check(); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Check collects every problem in the scenarios rather than
+// stopping at the first one
+func (cfg Scenarios) Check() ValidationErrors {
+	var errs ValidationErrors
+	if cfg.MaxConcurrent < 0 {
+		errs = append(errs, ValidationError{Message: "max_concurrent must not be negative"})
+	}
+	if cfg.Profile != nil {
+		errs = append(errs, cfg.Profile.check()...)
+	}
+	if cfg.Arrival != nil {
+		errs = append(errs, cfg.Arrival.check()...)
+		if cfg.Profile != nil && cfg.Arrival.Rate > 0 {
+			errs = append(errs, ValidationError{Message: "only one of profile or arrival rate can be set"})
+		}
+	}
+	if cfg.Soak != nil {
+		errs = append(errs, cfg.Soak.check()...)
+		if cfg.Profile != nil || (cfg.Arrival != nil && cfg.Arrival.Rate > 0) {
+			errs = append(errs, ValidationError{Message: "soak can not be combined with a profile or arrival rate"})
+		}
+	}
+	if cfg.CircuitBreaker != nil {
+		errs = append(errs, cfg.CircuitBreaker.check()...)
+	}
+	for _, expr := range cfg.Thresholds {
+		if _, err := ParseThreshold(expr); err != nil {
+			errs = append(errs, ValidationError{Message: err.Error()})
+		}
+	}
+	for i, user := range cfg.Users {
+		if user.Name == "" {
+			errs = append(errs, ValidationError{Message: fmt.Sprintf("user %d must set a name", i+1)})
+		}
+		switch {
+		case user.passwordErr != nil:
+			errs = append(errs, ValidationError{User: user.Name, Message: fmt.Sprintf("could not resolve password: %s", user.passwordErr)})
+		case user.numPasswordSources() > 1:
+			errs = append(errs, ValidationError{User: user.Name, Message: "must set only one of password, password_env, password_file or password_cmd"})
+		case user.Password == "":
+			errs = append(errs, ValidationError{User: user.Name, Message: "must set a password"})
 		}
 	}
 	users := lo.Map(cfg.Users, func(user User, _ int) string {
 		return user.Name
 	})
-	sessionUsers := lo.Map(cfg.Sessions, func(session Session, _ int) string {
-		return session.User
-	})
-	_, notUsers := lo.Difference(users, sessionUsers)
-	if len(notUsers) > 0 {
-		return fmt.Errorf("all session user(s) must be defined in user section, currently missing: %v", strings.Join(lo.Uniq(notUsers), ", "))
+	duplicates := lo.Uniq(lo.Filter(users, func(name string, i int) bool {
+		return name != "" && lo.IndexOf(users, name) != i
+	}))
+	for _, name := range duplicates {
+		errs = append(errs, ValidationError{User: name, Message: "user names must be unique, but this name is duplicated"})
 	}
 
-	for _, session := range cfg.Sessions {
+	for i, session := range cfg.Sessions {
+		num := i + 1
+		if session.User == "" {
+			errs = append(errs, ValidationError{Session: num, Message: "must set a user"})
+		} else if !lo.Contains(users, session.User) {
+			errs = append(errs, ValidationError{Session: num, User: session.User, Message: "user must be defined in the users section"})
+		}
 		if session.New != nil && !*session.New {
 			if session.Name == nil || (session.Name != nil && *session.Name == "") {
-				return errors.New("any non-new session must also have a name")
+				errs = append(errs, ValidationError{Session: num, User: session.User, Message: "any non-new session must also have a name"})
 			}
 		}
-		if session.RemoteCmdBase64 == "" {
-			return errors.New("must set remote_cmd_base64 for all sessions")
+		if session.Timeout != nil && *session.Timeout < 0 {
+			errs = append(errs, ValidationError{Session: num, User: session.User, Message: "timeout must not be negative"})
+		}
+		if session.Weight != nil && *session.Weight < 0 {
+			errs = append(errs, ValidationError{Session: num, User: session.User, Message: "weight must not be negative"})
+		}
+		if session.numRemoteCmds() != 1 {
+			errs = append(errs, ValidationError{Session: num, User: session.User, Message: "must set exactly one of remote_cmd_base64, remote_cmd or remote_cmd_file"})
 		}
 	}
-	return nil
+	return errs
 }
 
 func read(path string) (Scenarios, error) {
 	var config Scenarios
-	file, err := os.ReadFile(path)
+	decode, err := decoderFor(path)
 	if err != nil {
 		return config, err
 	}
-	err = json.Unmarshal(file, &config)
+	file, err := os.ReadFile(path)
 	if err != nil {
 		return config, err
 	}
-	err = config.Validate()
+	err = decode(file, &config)
 	if err != nil {
-		return config, err
+		return config, fmt.Errorf("could not decode %s: %w", path, err)
+	}
+	// problems loading parts of the scenarios are reported
+	// along with everything else Check finds
+	dir := filepath.Dir(path)
+	errs := config.expandTemplates()
+	errs = append(errs, config.resolveRemoteCmds(dir)...)
+	errs = append(errs, config.loadUsersFile(dir)...)
+	config.resolvePasswords(dir)
+	config.applyDefaults()
+	errs = append(errs, config.Check()...)
+	if len(errs) > 0 {
+		return config, errs
 	}
 	return config, nil
 }
@@ -5,6 +5,7 @@ import (
 
 	"github.com/dpastoor/plr/internal/config"
 	"github.com/metrumresearchgroup/wrapt"
+	"github.com/samber/lo"
 )
 
 func TestNewConfig(tt *testing.T) {
@@ -50,15 +51,17 @@ func TestNewConfig(tt *testing.T) {
 			},
 		},
 	}
-	config, err := config.Read("testdata/opts.json")
-	if err != nil {
-		tt.Fatalf("failed to read config: %v", err)
-	}
-	for i, test := range tests {
-		tt.Run(test.name, func(tt *testing.T) {
-			t := wrapt.WrapT(tt)
-			t.R.Equal(test.session, config.Sessions[i])
-		})
+	for _, path := range []string{"testdata/opts.json", "testdata/opts.yaml", "testdata/opts.toml"} {
+		cfg, err := config.Read(path)
+		if err != nil {
+			tt.Fatalf("failed to read config %s: %v", path, err)
+		}
+		for i, test := range tests {
+			tt.Run(path+"/"+test.name, func(tt *testing.T) {
+				t := wrapt.WrapT(tt)
+				t.R.Equal(test.session, cfg.Sessions[i])
+			})
+		}
 	}
 }
 
@@ -71,6 +74,14 @@ func TestMissingUser(tt *testing.T) {
 			name: "missing user2",
 			path: "testdata/missing-user.json",
 		},
+		{
+			name: "missing user2 yaml",
+			path: "testdata/missing-user.yaml",
+		},
+		{
+			name: "missing user2 toml",
+			path: "testdata/missing-user.toml",
+		},
 	}
 	for _, test := range tests {
 		tt.Run(test.name, func(tt *testing.T) {
@@ -81,3 +92,285 @@ func TestMissingUser(tt *testing.T) {
 		})
 	}
 }
+
+func TestDecodeErrorLine(tt *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		line string
+	}{
+		{
+			name: "json",
+			path: "testdata/bad-type.json",
+			line: "line 11",
+		},
+		{
+			name: "yaml",
+			path: "testdata/bad-type.yaml",
+			line: "line 6",
+		},
+		{
+			name: "toml",
+			path: "testdata/bad-type.toml",
+			line: "line 7",
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+			_, err := config.Read(test.path)
+			t.R.Error(err)
+			t.A.ErrorContains(err, test.line)
+		})
+	}
+}
+
+func TestUnsupportedExtension(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	_, err := config.Read("testdata/scenarios.ini")
+	t.R.Error(err)
+	t.A.ErrorContains(err, "unsupported scenarios file extension")
+}
+
+func TestSessionTemplates(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	cfg, err := config.Read("testdata/templates.yaml")
+	t.R.NoError(err)
+	// 1 explicit session + 2 repeats x 2 users x 2 commands
+	t.R.Len(cfg.Sessions, 9)
+	t.A.Equal("user1", cfg.Sessions[0].User)
+	t.A.Nil(cfg.Sessions[0].Delay)
+	got := lo.Map(cfg.Sessions[1:5], func(s config.Session, _ int) string {
+		return s.User + ":" + s.RemoteCmdBase64
+	})
+	t.A.Equal([]string{
+		"user1:c291cmNlKCJhLlIiKQ==",
+		"user1:c291cmNlKCJiLlIiKQ==",
+		"user2:c291cmNlKCJhLlIiKQ==",
+		"user2:c291cmNlKCJiLlIiKQ==",
+	}, got)
+	for _, s := range cfg.Sessions[1:] {
+		t.A.Equal(2.0, *s.Delay)
+	}
+}
+
+func TestSessionTemplateInvalid(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	cfg := config.Scenarios{
+		Users: []config.User{{Name: "user1", Password: "password1"}},
+		SessionTemplates: []config.SessionTemplate{
+			{Users: []string{"user1", "user3"}, Session: config.Session{RemoteCmdBase64: "c291cmNlKCJ0ZXN0LlIiKQ=="}},
+		},
+	}
+	t.R.NoError(cfg.ExpandTemplates())
+	t.A.ErrorContains(cfg.Validate(), "user3")
+}
+
+func TestRemoteCmds(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	cfg, err := config.Read("testdata/remote-cmd.yaml")
+	t.R.NoError(err)
+	t.R.Len(cfg.Sessions, 4)
+	for _, s := range cfg.Sessions {
+		t.A.Equal("c291cmNlKCJ0ZXN0LlIiKQ==", s.RemoteCmdBase64)
+		t.A.Empty(s.RemoteCmd)
+		t.A.Empty(s.RemoteCmdFile)
+	}
+}
+
+func TestRemoteCmdsExactlyOne(tt *testing.T) {
+	tests := []struct {
+		name    string
+		session config.Session
+	}{
+		{
+			name:    "none",
+			session: config.Session{User: "user1"},
+		},
+		{
+			name: "multiple",
+			session: config.Session{
+				User:            "user1",
+				RemoteCmdBase64: "c291cmNlKCJ0ZXN0LlIiKQ==",
+				RemoteCmd:       `source("test.R")`,
+			},
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+			cfg := config.Scenarios{
+				Users:    []config.User{{Name: "user1", Password: "password1"}},
+				Sessions: []config.Session{test.session},
+			}
+			t.A.ErrorContains(cfg.Validate(), "exactly one of remote_cmd_base64, remote_cmd or remote_cmd_file")
+		})
+	}
+}
+
+func TestPasswordSources(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	tt.Setenv("PLR_TEST_PASSWORD", "password1")
+	cfg, err := config.Read("testdata/password-sources.yaml")
+	t.R.NoError(err)
+	got := lo.Map(cfg.Users, func(u config.User, _ int) string {
+		return u.Name + ":" + u.Password
+	})
+	t.A.Equal([]string{"user1:password1", "user2:password2", "user3:password3"}, got)
+}
+
+func TestPasswordSourceUnresolved(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	tt.Setenv("PLR_TEST_PASSWORD", "")
+	_, err := config.Read("testdata/password-sources.yaml")
+	t.R.Error(err)
+	t.A.ErrorContains(err, "user1")
+	t.A.ErrorContains(err, "PLR_TEST_PASSWORD")
+}
+
+func TestUsersFile(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	cfg, err := config.Read("testdata/users-file.yaml")
+	t.R.NoError(err)
+	t.R.Equal([]config.User{
+		{Name: "user1", Password: "password1"},
+		{Name: "user2", Password: "password2", Attributes: map[string]string{"team": "blue"}},
+		{Name: "user3", Password: "password3", Attributes: map[string]string{"team": "red"}},
+	}, cfg.Users)
+}
+
+func TestUsersFileDuplicate(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	_, err := config.Read("testdata/users-file-duplicate.yaml")
+	t.R.Error(err)
+	t.A.ErrorContains(err, "user user2: user names must be unique")
+}
+
+func TestCheckCollectsAllErrors(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	cfg := config.Scenarios{
+		Users: []config.User{
+			{Name: "user1", Password: "password1"},
+			{Name: "user2"},
+		},
+		Sessions: []config.Session{
+			{User: "user1", RemoteCmd: `source("test.R")`},
+			{User: "user3", RemoteCmd: `source("test.R")`},
+			{User: "user1", New: config.BoolPtr(false)},
+		},
+	}
+	t.R.Equal(config.ValidationErrors{
+		{User: "user2", Message: "must set a password"},
+		{Session: 2, User: "user3", Message: "user must be defined in the users section"},
+		{Session: 3, User: "user1", Message: "any non-new session must also have a name"},
+		{Session: 3, User: "user1", Message: "must set exactly one of remote_cmd_base64, remote_cmd or remote_cmd_file"},
+	}, cfg.Check())
+}
+
+func TestReadCollectsLoadErrors(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	_, err := config.Read("testdata/load-errors.yaml")
+	var errs config.ValidationErrors
+	t.R.ErrorAs(err, &errs)
+	msgs := lo.Map(errs, func(e config.ValidationError, _ int) string {
+		return e.Error()
+	})
+	t.R.Len(msgs, 4)
+	t.A.Equal("could not expand session template 1: repeat must not be negative, got -1", msgs[0])
+	t.A.Contains(msgs[1], "session 1 (user user1): could not read remote_cmd_file")
+	t.A.Contains(msgs[2], "could not read users_file")
+	t.A.Equal("session 2 (user user2): user must be defined in the users section", msgs[3])
+}
+
+func TestSchema(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	schema := config.Schema()
+	defs := schema["definitions"].(map[string]interface{})
+	session := defs["Session"].(map[string]interface{})
+	properties := session["properties"].(map[string]interface{})
+	for _, key := range []string{"user", "remote_cmd_base64", "remote_cmd", "remote_cmd_file", "name", "new", "delay"} {
+		t.A.Contains(properties, key)
+	}
+	t.A.Equal("number", properties["delay"].(map[string]interface{})["type"])
+	t.A.NotEmpty(properties["headless"].(map[string]interface{})["description"])
+	then := session["then"].(map[string]interface{})
+	t.A.Equal([]string{"name"}, then["required"])
+	t.A.Contains(defs, "User")
+	t.A.Contains(defs, "SessionTemplate")
+}
+
+func TestDefaults(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	cfg, err := config.Read("testdata/defaults.yaml")
+	t.R.NoError(err)
+	tests := []struct {
+		headless bool
+		image    string
+		ncpu     int
+		memory   int
+	}{
+		{headless: false, image: "user1-image", ncpu: 2, memory: 1024},
+		{headless: false, image: "user1-image", ncpu: 4, memory: 1024},
+		{headless: false, image: "base", ncpu: 1, memory: 1024},
+	}
+	for i, test := range tests {
+		s := cfg.Sessions[i]
+		t.A.Equal(test.headless, *s.Headless)
+		t.A.Equal(test.image, *s.Image)
+		t.A.Equal(test.ncpu, *s.Ncpu)
+		t.A.Equal(test.memory, *s.Memory)
+	}
+}
+
+func TestParseThreshold(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	tests := []struct {
+		expr  string
+		value float64
+		pass  float64
+		fail  float64
+	}{
+		{expr: "p95_duration < 90s", value: 90, pass: 89.9, fail: 90},
+		{expr: "max_duration<=2m", value: 120, pass: 120, fail: 121},
+		{expr: "mean_duration < 30", value: 30, pass: 29, fail: 31},
+		{expr: "error_rate < 2%", value: 0.02, pass: 0.01, fail: 0.02},
+		{expr: "success_rate >= 0.95", value: 0.95, pass: 0.95, fail: 0.9},
+		{expr: " max_concurrent_reached >= 50 ", value: 50, pass: 50, fail: 49},
+	}
+	for _, test := range tests {
+		th, err := config.ParseThreshold(test.expr)
+		t.R.NoError(err, test.expr)
+		t.A.InDelta(test.value, th.Value, 1e-9, test.expr)
+		t.A.True(th.Passes(test.pass), test.expr)
+		t.A.False(th.Passes(test.fail), test.expr)
+	}
+	for _, expr := range []string{"p95_duration", "p42_duration < 1s", "error_rate < 2", "p95_duration < fast", "failed_count ~ 1"} {
+		_, err := config.ParseThreshold(expr)
+		t.A.Error(err, expr)
+	}
+	th, err := config.ParseThreshold("error_rate < 2%")
+	t.R.NoError(err)
+	t.A.Equal("1.50%", th.Format(0.015))
+}
+
+func TestCheckThresholds(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	cfg := config.Scenarios{Thresholds: []string{"p95_duration < 90s", "error_rate < lots"}}
+	errs := cfg.Check()
+	t.R.Len(errs, 1)
+	t.A.Contains(errs[0].Message, "error_rate < lots")
+}
+
+func TestCheckCircuitBreaker(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	cfg := config.Scenarios{CircuitBreaker: &config.CircuitBreaker{Window: 5, MaxFailures: 6}}
+	t.A.Equal(config.ValidationErrors{
+		{Message: "circuit_breaker max_failures must be between 0 and the window of 5"},
+	}, cfg.Check())
+	cfg.CircuitBreaker = &config.CircuitBreaker{Window: 5}
+	t.A.Equal(config.ValidationErrors{
+		{Message: "circuit_breaker must set max_failures or max_failure_ratio"},
+	}, cfg.Check())
+	cfg.CircuitBreaker = &config.CircuitBreaker{Window: 5, MaxFailureRatio: 0.5}
+	t.A.Empty(cfg.Check())
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// decoder unmarshals the raw contents of a scenarios file into v
+type decoder func(data []byte, v interface{}) error
+
+// decoderFor picks the decoder to use based on the file extension
+func decoderFor(path string) (decoder, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		return decodeJSON, nil
+	case ".yaml", ".yml":
+		return decodeYAML, nil
+	case ".toml":
+		return decodeTOML, nil
+	default:
+		return nil, fmt.Errorf("unsupported scenarios file extension %q for %s, must be one of .json, .yaml, .yml or .toml", ext, path)
+	}
+}
+
+func decodeJSON(data []byte, v interface{}) error {
+	err := json.Unmarshal(data, v)
+	if err == nil {
+		return nil
+	}
+	// encoding/json only reports byte offsets, so translate them into
+	// a line and column to be consistent with the yaml and toml decoders
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		line, col := position(data, syntaxErr.Offset)
+		return fmt.Errorf("line %d, column %d: %w", line, col, err)
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		line, col := position(data, typeErr.Offset)
+		return fmt.Errorf("line %d, column %d: %w", line, col, err)
+	}
+	return err
+}
+
+// decodeYAML decodes yaml, the yaml decoder already
+// includes the line in both syntax and type errors
+func decodeYAML(data []byte, v interface{}) error {
+	return yaml.Unmarshal(data, v)
+}
+
+func decodeTOML(data []byte, v interface{}) error {
+	err := toml.Unmarshal(data, v)
+	if err == nil {
+		return nil
+	}
+	var decodeErr *toml.DecodeError
+	if errors.As(err, &decodeErr) {
+		line, col := decodeErr.Position()
+		return fmt.Errorf("line %d, column %d: %w", line, col, err)
+	}
+	return err
+}
+
+// position converts a byte offset into a 1-indexed line and column
+func position(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
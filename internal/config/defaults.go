@@ -0,0 +1,49 @@
+package config
+
+// SessionDefaults are values applied to every session that does not set them itself.
+// Defaults are layered, from lowest to highest precedence:
+//  1. the scenarios level defaults
+//  2. the defaults of the session's user
+//  3. the values set on the session, including those from a session template
+type SessionDefaults struct {
+	Headless *bool    `json:"headless,omitempty" yaml:"headless,omitempty" toml:"headless,omitempty" desc:"run the browser in headless mode"`
+	Ncpu     *int     `json:"ncpu,omitempty" yaml:"ncpu,omitempty" toml:"ncpu,omitempty" desc:"number of cpus to request for the session"`
+	Memory   *int     `json:"memory,omitempty" yaml:"memory,omitempty" toml:"memory,omitempty" desc:"memory to request for the session"`
+	Image    *string  `json:"image,omitempty" yaml:"image,omitempty" toml:"image,omitempty" desc:"image to use for the session"`
+	Timeout  *float64 `json:"timeout,omitempty" yaml:"timeout,omitempty" toml:"timeout,omitempty" desc:"seconds the session may run before it is stopped and recorded as timed out"`
+}
+
+// fill sets any value on the session that is not already set
+func (d *SessionDefaults) fill(session *Session) {
+	if d == nil {
+		return
+	}
+	if session.Headless == nil {
+		session.Headless = d.Headless
+	}
+	if session.Ncpu == nil {
+		session.Ncpu = d.Ncpu
+	}
+	if session.Memory == nil {
+		session.Memory = d.Memory
+	}
+	if session.Image == nil {
+		session.Image = d.Image
+	}
+	if session.Timeout == nil {
+		session.Timeout = d.Timeout
+	}
+}
+
+// applyDefaults fills in each session from the user defaults
+// and then the scenarios defaults, so the more specific value wins
+func (cfg *Scenarios) applyDefaults() {
+	userDefaults := make(map[string]*SessionDefaults, len(cfg.Users))
+	for _, user := range cfg.Users {
+		userDefaults[user.Name] = user.Defaults
+	}
+	for i := range cfg.Sessions {
+		userDefaults[cfg.Sessions[i].User].fill(&cfg.Sessions[i])
+		cfg.Defaults.fill(&cfg.Sessions[i])
+	}
+}
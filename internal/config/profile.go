@@ -0,0 +1,87 @@
+package config
+
+import "fmt"
+
+// Profile describes the number of concurrent sessions over time, similar to k6 stages.
+// For example ramping up to 10 sessions over a minute, holding for 5 minutes
+// and ramping back down over a minute would be the stages
+// {60, 10}, {300, 10}, {60, 0}
+type Profile struct {
+	Stages []Stage `json:"stages" yaml:"stages" toml:"stages" desc:"stages run in order, starting from 0 concurrent sessions"`
+}
+
+// Stage linearly moves the target number of concurrent sessions
+// from the previous stage's target to Target over Duration seconds
+type Stage struct {
+	Duration float64 `json:"duration" yaml:"duration" toml:"duration" desc:"seconds the stage lasts"`
+	Target   int     `json:"target" yaml:"target" toml:"target" desc:"number of concurrent sessions to reach by the end of the stage"`
+}
+
+func (p Profile) check() ValidationErrors {
+	var errs ValidationErrors
+	if len(p.Stages) == 0 {
+		errs = append(errs, ValidationError{Message: "profile must have at least one stage"})
+	}
+	total := 0.0
+	for i, stage := range p.Stages {
+		total += stage.Duration
+		if stage.Duration < 0 {
+			errs = append(errs, ValidationError{Message: fmt.Sprintf("profile stage %d duration must not be negative", i+1)})
+		}
+		if stage.Target < 0 {
+			errs = append(errs, ValidationError{Message: fmt.Sprintf("profile stage %d target must not be negative", i+1)})
+		}
+	}
+	if len(p.Stages) > 0 && total <= 0 {
+		errs = append(errs, ValidationError{Message: "profile stages must last longer than 0 seconds in total"})
+	}
+	return errs
+}
+
+// Arrival controls when sessions launch when not following a profile
+type Arrival struct {
+	Rate   float64 `json:"rate,omitempty" yaml:"rate,omitempty" toml:"rate,omitempty" desc:"average number of sessions launched per second, with launch times drawn from a Poisson process instead of each session's delay"`
+	Jitter float64 `json:"jitter,omitempty" yaml:"jitter,omitempty" toml:"jitter,omitempty" desc:"seconds of uniform random jitter, in either direction, applied to each session's delay"`
+}
+
+func (a Arrival) check() ValidationErrors {
+	var errs ValidationErrors
+	if a.Rate < 0 {
+		errs = append(errs, ValidationError{Message: "arrival rate must not be negative"})
+	}
+	if a.Jitter < 0 {
+		errs = append(errs, ValidationError{Message: "arrival jitter must not be negative"})
+	}
+	return errs
+}
+
+const (
+	// SoakRoundRobin relaunches sessions from the pool in order
+	SoakRoundRobin = "round-robin"
+	// SoakWeighted relaunches sessions at random, weighted by each session's weight
+	SoakWeighted = "weighted"
+)
+
+// Soak keeps a number of sessions running for a fixed duration,
+// relaunching sessions from the pool as running ones finish
+type Soak struct {
+	Concurrent int     `json:"concurrent" yaml:"concurrent" toml:"concurrent" desc:"number of sessions to keep running"`
+	Duration   float64 `json:"duration" yaml:"duration" toml:"duration" desc:"seconds to keep launching sessions for"`
+	Selection  string  `json:"selection,omitempty" yaml:"selection,omitempty" toml:"selection,omitempty" desc:"how to pick the next session, round-robin (default) or weighted"`
+}
+
+func (s Soak) check() ValidationErrors {
+	var errs ValidationErrors
+	if s.Concurrent <= 0 {
+		errs = append(errs, ValidationError{Message: "soak concurrent must be greater than 0"})
+	}
+	if s.Duration <= 0 {
+		errs = append(errs, ValidationError{Message: "soak duration must be greater than 0"})
+	}
+	switch s.Selection {
+	case "", SoakRoundRobin, SoakWeighted:
+	default:
+		errs = append(errs, ValidationError{Message: fmt.Sprintf("unknown soak selection %q, must be %s or %s", s.Selection, SoakRoundRobin, SoakWeighted)})
+	}
+	return errs
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// numRemoteCmds returns how many of the remote command fields are set
+func (s Session) numRemoteCmds() int {
+	n := 0
+	for _, cmd := range []string{s.RemoteCmdBase64, s.RemoteCmd, s.RemoteCmdFile} {
+		if cmd != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// resolveRemoteCmds base64 encodes any remote_cmd or remote_cmd_file
+// into remote_cmd_base64 so the runner only has to deal with a single form.
+// remote_cmd_file paths are relative to dir, which should be the directory
+// of the scenarios file. Sessions that do not set exactly one remote command
+// are left untouched for Validate to report, as are sessions whose
+// remote_cmd_file can not be read, which are returned as ValidationErrors
+func (cfg *Scenarios) resolveRemoteCmds(dir string) ValidationErrors {
+	var errs ValidationErrors
+	for i := range cfg.Sessions {
+		session := &cfg.Sessions[i]
+		if session.numRemoteCmds() != 1 || session.RemoteCmdBase64 != "" {
+			continue
+		}
+		cmd := []byte(session.RemoteCmd)
+		if session.RemoteCmdFile != "" {
+			path := session.RemoteCmdFile
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			contents, err := os.ReadFile(path)
+			if err != nil {
+				errs = append(errs, ValidationError{Session: i + 1, User: session.User, Message: fmt.Sprintf("could not read remote_cmd_file: %s", err)})
+				continue
+			}
+			cmd = contents
+		}
+		session.RemoteCmdBase64 = base64.StdEncoding.EncodeToString(cmd)
+		session.RemoteCmd = ""
+		session.RemoteCmdFile = ""
+	}
+	return errs
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// schemaExtender lets a type add rules to its generated schema
+// that can not be expressed through the struct fields alone
+type schemaExtender interface {
+	extendSchema(schema map[string]interface{})
+}
+
+// Schema returns a JSON Schema (draft-07) for the scenarios format.
+// It is generated from the Scenarios struct and the json and desc tags
+// of its fields, so it always matches what Read accepts
+func Schema() map[string]interface{} {
+	defs := make(map[string]interface{})
+	ref := schemaFor(reflect.TypeOf(Scenarios{}), defs)
+	return map[string]interface{}{
+		"$schema":     "http://json-schema.org/draft-07/schema#",
+		"title":       "plr scenarios",
+		"$ref":        ref["$ref"],
+		"definitions": defs,
+	}
+}
+
+func schemaFor(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaFor(t.Elem(), defs)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem(), defs)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem(), defs)}
+	case reflect.Struct:
+		ref := map[string]interface{}{"$ref": "#/definitions/" + t.Name()}
+		if _, ok := defs[t.Name()]; ok {
+			return ref
+		}
+		// reserve the name before recursing in case of self referencing types
+		defs[t.Name()] = nil
+		defs[t.Name()] = structSchema(t, defs)
+		return ref
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+func structSchema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		property := schemaFor(field.Type, defs)
+		if desc := field.Tag.Get("desc"); desc != "" {
+			if _, isRef := property["$ref"]; isRef {
+				// draft-07 ignores siblings of $ref so wrap it to keep the description
+				property = map[string]interface{}{"allOf": []interface{}{property}}
+			}
+			property["description"] = desc
+		}
+		properties[name] = property
+	}
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if extender, ok := reflect.Zero(t).Interface().(schemaExtender); ok {
+		extender.extendSchema(schema)
+	}
+	return schema
+}
+
+// extendSchema allows a $schema key so editors can associate a scenarios file with the schema
+func (Scenarios) extendSchema(schema map[string]interface{}) {
+	schema["properties"].(map[string]interface{})["$schema"] = map[string]interface{}{"type": "string"}
+}
+
+func (User) extendSchema(schema map[string]interface{}) {
+	schema["required"] = []string{"name"}
+}
+
+// extendSchema adds the rule that a session that is not new must have a name
+func (Session) extendSchema(schema map[string]interface{}) {
+	schema["if"] = map[string]interface{}{
+		"properties": map[string]interface{}{
+			"new": map[string]interface{}{"const": false},
+		},
+		"required": []string{"new"},
+	}
+	schema["then"] = map[string]interface{}{
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{"minLength": 1},
+		},
+		"required": []string{"name"},
+	}
+}
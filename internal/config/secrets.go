@@ -0,0 +1,115 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// passwordCmdTimeout bounds how long a password_cmd may take to print the password
+const passwordCmdTimeout = 30 * time.Second
+
+// numPasswordSources returns how many ways of providing a password are set
+func (u User) numPasswordSources() int {
+	n := 0
+	for _, src := range []string{u.Password, u.PasswordEnv, u.PasswordFile, u.PasswordCmd} {
+		if src != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// Secrets returns every password known to the scenarios,
+// including those resolved from a password source
+func (cfg Scenarios) Secrets() []string {
+	var secrets []string
+	for _, user := range cfg.Users {
+		if user.Password != "" {
+			secrets = append(secrets, user.Password)
+		}
+	}
+	return secrets
+}
+
+// resolvePasswords sets the password for any user with a password_env,
+// password_file or password_cmd. password_file paths are relative to dir,
+// which should be the directory of the scenarios file.
+// Failures are kept on the user so Validate can report which user's
+// password could not be resolved
+func (cfg *Scenarios) resolvePasswords(dir string) {
+	for i := range cfg.Users {
+		user := &cfg.Users[i]
+		if user.numPasswordSources() != 1 || user.Password != "" {
+			continue
+		}
+		password, err := user.resolvePassword(dir)
+		if err != nil {
+			user.passwordErr = err
+			continue
+		}
+		user.Password = password
+		user.PasswordEnv = ""
+		user.PasswordFile = ""
+		user.PasswordCmd = ""
+	}
+}
+
+func (u User) resolvePassword(dir string) (string, error) {
+	switch {
+	case u.PasswordEnv != "":
+		password, ok := os.LookupEnv(u.PasswordEnv)
+		if !ok || password == "" {
+			return "", fmt.Errorf("password_env %s is not set", u.PasswordEnv)
+		}
+		return password, nil
+	case u.PasswordFile != "":
+		path := u.PasswordFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("could not read password_file: %w", err)
+		}
+		password := strings.TrimRight(string(contents), "\r\n")
+		if password == "" {
+			return "", fmt.Errorf("password_file %s is empty", u.PasswordFile)
+		}
+		return password, nil
+	case u.PasswordCmd != "":
+		return runPasswordCmd(u.PasswordCmd)
+	}
+	return "", errors.New("no password source set")
+}
+
+// runPasswordCmd runs cmd through the system shell and
+// uses the first line of its stdout as the password
+func runPasswordCmd(cmd string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), passwordCmdTimeout)
+	defer cancel()
+	var c *exec.Cmd
+	if runtime.GOOS == "windows" {
+		c = exec.CommandContext(ctx, "cmd", "/C", cmd)
+	} else {
+		c = exec.CommandContext(ctx, "sh", "-c", cmd)
+	}
+	var stdout, stderr bytes.Buffer
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	if err := c.Run(); err != nil {
+		return "", fmt.Errorf("password_cmd failed with err %s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	password := strings.TrimRight(strings.SplitN(stdout.String(), "\n", 2)[0], "\r")
+	if password == "" {
+		return "", errors.New("password_cmd did not print a password")
+	}
+	return password, nil
+}
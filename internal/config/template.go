@@ -0,0 +1,94 @@
+package config
+
+import "fmt"
+
+// SessionTemplate generates Sessions from a matrix of
+// users x remote commands x repeat count.
+// Any value not provided by the matrix is taken from Session,
+// so the template session acts as the base for every expanded session
+type SessionTemplate struct {
+	Users            []string `json:"users,omitempty" yaml:"users,omitempty" toml:"users,omitempty" desc:"users to create sessions for, defaults to the user set on session"`
+	RemoteCmdsBase64 []string `json:"remote_cmds_base64,omitempty" yaml:"remote_cmds_base64,omitempty" toml:"remote_cmds_base64,omitempty" desc:"base64 encoded commands to run for each user"`
+	RemoteCmds       []string `json:"remote_cmds,omitempty" yaml:"remote_cmds,omitempty" toml:"remote_cmds,omitempty" desc:"commands to run for each user"`
+	RemoteCmdFiles   []string `json:"remote_cmd_files,omitempty" yaml:"remote_cmd_files,omitempty" toml:"remote_cmd_files,omitempty" desc:"files with commands to run for each user"`
+	Repeat           int      `json:"repeat,omitempty" yaml:"repeat,omitempty" toml:"repeat,omitempty" desc:"number of times to repeat the full matrix, defaults to 1"`
+	Session          Session  `json:"session" yaml:"session" toml:"session" desc:"base session every expanded session starts from"`
+}
+
+// Expand returns the concrete sessions for the template.
+// Sessions are ordered by repeat, then user, then remote command
+// so that each repetition cycles through all users before the next starts
+func (t SessionTemplate) Expand() ([]Session, error) {
+	if t.Repeat < 0 {
+		return nil, fmt.Errorf("repeat must not be negative, got %d", t.Repeat)
+	}
+	repeat := t.Repeat
+	if repeat == 0 {
+		repeat = 1
+	}
+	users := t.Users
+	if len(users) == 0 {
+		users = []string{t.Session.User}
+	}
+	cmds := t.remoteCmds()
+	sessions := make([]Session, 0, repeat*len(users)*len(cmds))
+	for r := 0; r < repeat; r++ {
+		for _, user := range users {
+			for _, cmd := range cmds {
+				session := t.Session
+				session.User = user
+				session.RemoteCmdBase64 = cmd.RemoteCmdBase64
+				session.RemoteCmd = cmd.RemoteCmd
+				session.RemoteCmdFile = cmd.RemoteCmdFile
+				sessions = append(sessions, session)
+			}
+		}
+	}
+	return sessions, nil
+}
+
+// ExpandTemplates appends the sessions generated by all
+// session templates after any explicitly defined sessions.
+// Templates that can not be expanded are skipped and returned as ValidationErrors
+func (cfg *Scenarios) ExpandTemplates() error {
+	if errs := cfg.expandTemplates(); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (cfg *Scenarios) expandTemplates() ValidationErrors {
+	var errs ValidationErrors
+	for i, template := range cfg.SessionTemplates {
+		sessions, err := template.Expand()
+		if err != nil {
+			errs = append(errs, ValidationError{Message: fmt.Sprintf("could not expand session template %d: %s", i+1, err)})
+			continue
+		}
+		cfg.Sessions = append(cfg.Sessions, sessions...)
+	}
+	return errs
+}
+
+// remoteCmds returns the remote command axis of the matrix as sessions
+// with only the remote command fields set
+func (t SessionTemplate) remoteCmds() []Session {
+	var cmds []Session
+	for _, cmd := range t.RemoteCmdsBase64 {
+		cmds = append(cmds, Session{RemoteCmdBase64: cmd})
+	}
+	for _, cmd := range t.RemoteCmds {
+		cmds = append(cmds, Session{RemoteCmd: cmd})
+	}
+	for _, file := range t.RemoteCmdFiles {
+		cmds = append(cmds, Session{RemoteCmdFile: file})
+	}
+	if len(cmds) == 0 {
+		cmds = append(cmds, Session{
+			RemoteCmdBase64: t.Session.RemoteCmdBase64,
+			RemoteCmd:       t.Session.RemoteCmd,
+			RemoteCmdFile:   t.Session.RemoteCmdFile,
+		})
+	}
+	return cmds
+}
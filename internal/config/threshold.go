@@ -0,0 +1,164 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetricKind is what a threshold metric measures, which decides
+// how its value is written
+type MetricKind int
+
+const (
+	// DurationMetric values are seconds, written as a go duration like 90s or 1m30s
+	DurationMetric MetricKind = iota
+	// RateMetric values are fractions, written as a percentage like 2% or a fraction like 0.02
+	RateMetric
+	// CountMetric values are numbers of sessions
+	CountMetric
+)
+
+// ThresholdMetrics are the metrics a threshold can check
+var ThresholdMetrics = map[string]MetricKind{
+	"min_duration":           DurationMetric,
+	"mean_duration":          DurationMetric,
+	"p50_duration":           DurationMetric,
+	"p90_duration":           DurationMetric,
+	"p95_duration":           DurationMetric,
+	"p99_duration":           DurationMetric,
+	"max_duration":           DurationMetric,
+	"error_rate":             RateMetric,
+	"timeout_rate":           RateMetric,
+	"success_rate":           RateMetric,
+	"completed_count":        CountMetric,
+	"failed_count":           CountMetric,
+	"timeout_count":          CountMetric,
+	"stopped_count":          CountMetric,
+	"not_started_count":      CountMetric,
+	"max_concurrent_reached": CountMetric,
+}
+
+var thresholdPattern = regexp.MustCompile(`^\s*([a-z0-9_]+)\s*(<=|>=|==|!=|<|>)\s*(\S+)\s*$`)
+
+// Threshold is a pass/fail check on a metric of the whole run,
+// such as p95_duration < 90s or error_rate < 2%
+type Threshold struct {
+	Metric string
+	Op     string
+	// Value is in seconds for durations and a fraction for rates
+	Value float64
+	Expr  string
+}
+
+// ParseThreshold parses an expression of the form <metric> <op> <value>
+func ParseThreshold(expr string) (Threshold, error) {
+	m := thresholdPattern.FindStringSubmatch(expr)
+	if m == nil {
+		return Threshold{}, fmt.Errorf("threshold %q must look like <metric> <op> <value>, for example p95_duration < 90s", expr)
+	}
+	t := Threshold{Metric: m[1], Op: m[2], Expr: strings.TrimSpace(expr)}
+	kind, ok := ThresholdMetrics[t.Metric]
+	if !ok {
+		metrics := make([]string, 0, len(ThresholdMetrics))
+		for name := range ThresholdMetrics {
+			metrics = append(metrics, name)
+		}
+		sort.Strings(metrics)
+		return t, fmt.Errorf("threshold %q has unknown metric %s, must be one of %s", expr, t.Metric, strings.Join(metrics, ", "))
+	}
+	value, err := parseMetricValue(kind, m[3])
+	if err != nil {
+		return t, fmt.Errorf("threshold %q: %w", expr, err)
+	}
+	t.Value = value
+	return t, nil
+}
+
+func parseMetricValue(kind MetricKind, s string) (float64, error) {
+	switch kind {
+	case DurationMetric:
+		if d, err := time.ParseDuration(s); err == nil {
+			return d.Seconds(), nil
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s is not a duration like 90s or a number of seconds", s)
+		}
+		return v, nil
+	case RateMetric:
+		if strings.HasSuffix(s, "%") {
+			v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+			if err != nil {
+				return 0, fmt.Errorf("%s is not a percentage", s)
+			}
+			return v / 100, nil
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v > 1 {
+			return 0, fmt.Errorf("%s is not a percentage like 2%% or a fraction like 0.02", s)
+		}
+		return v, nil
+	default:
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s is not a number", s)
+		}
+		return v, nil
+	}
+}
+
+// Kind returns what the threshold's metric measures
+func (t Threshold) Kind() MetricKind {
+	return ThresholdMetrics[t.Metric]
+}
+
+// Passes reports whether actual satisfies the threshold
+func (t Threshold) Passes(actual float64) bool {
+	switch t.Op {
+	case "<":
+		return actual < t.Value
+	case "<=":
+		return actual <= t.Value
+	case ">":
+		return actual > t.Value
+	case ">=":
+		return actual >= t.Value
+	case "==":
+		return actual == t.Value
+	default:
+		return actual != t.Value
+	}
+}
+
+// Format writes a value of the threshold's metric the way it would be written in a threshold
+func (t Threshold) Format(v float64) string {
+	switch t.Kind() {
+	case DurationMetric:
+		return time.Duration(v * float64(time.Second)).Round(time.Millisecond).String()
+	case RateMetric:
+		return strconv.FormatFloat(v*100, 'f', 2, 64) + "%"
+	default:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+}
+
+func (t Threshold) String() string {
+	return t.Expr
+}
+
+// ParseThresholds parses every threshold in the scenarios
+func (cfg Scenarios) ParseThresholds() ([]Threshold, error) {
+	thresholds := make([]Threshold, 0, len(cfg.Thresholds))
+	for _, expr := range cfg.Thresholds {
+		t, err := ParseThreshold(expr)
+		if err != nil {
+			return nil, err
+		}
+		thresholds = append(thresholds, t)
+	}
+	return thresholds, nil
+}
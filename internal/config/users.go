@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/dpastoor/plr/internal/reader"
+)
+
+// usersFileColumns are the csv columns that map onto User fields,
+// any other column is kept in User.Attributes
+var usersFileColumns = map[string]func(*User, string){
+	"name":          func(u *User, v string) { u.Name = v },
+	"password":      func(u *User, v string) { u.Password = v },
+	"password_env":  func(u *User, v string) { u.PasswordEnv = v },
+	"password_file": func(u *User, v string) { u.PasswordFile = v },
+	"password_cmd":  func(u *User, v string) { u.PasswordCmd = v },
+}
+
+// loadUsersFile appends the users from the users_file csv, relative to dir,
+// after any users defined in the scenarios file itself.
+// A users_file that can not be loaded is returned as ValidationErrors
+func (cfg *Scenarios) loadUsersFile(dir string) ValidationErrors {
+	if cfg.UsersFile == "" {
+		return nil
+	}
+	path := cfg.UsersFile
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	records, err := reader.ReadRecords(path)
+	if err != nil {
+		return ValidationErrors{{Message: fmt.Sprintf("could not read users_file: %s", err)}}
+	}
+	if len(records) > 0 {
+		if _, ok := records[0]["name"]; !ok {
+			return ValidationErrors{{Message: fmt.Sprintf("users_file %s must have a name column", cfg.UsersFile)}}
+		}
+	}
+	for _, record := range records {
+		var user User
+		for column, value := range record {
+			if set, ok := usersFileColumns[column]; ok {
+				set(&user, value)
+				continue
+			}
+			if user.Attributes == nil {
+				user.Attributes = make(map[string]string)
+			}
+			user.Attributes[column] = value
+		}
+		cfg.Users = append(cfg.Users, user)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError is a single problem found in the scenarios,
+// pointing at the session and/or user it was found on
+type ValidationError struct {
+	// Session is the 1-indexed session number, matching the numbering
+	// used when running, or 0 if the problem is not with a session
+	Session int    `json:"session,omitempty"`
+	User    string `json:"user,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	switch {
+	case e.Session > 0 && e.User != "":
+		return fmt.Sprintf("session %d (user %s): %s", e.Session, e.User, e.Message)
+	case e.Session > 0:
+		return fmt.Sprintf("session %d: %s", e.Session, e.Message)
+	case e.User != "":
+		return fmt.Sprintf("user %s: %s", e.User, e.Message)
+	default:
+		return e.Message
+	}
+}
+
+// ValidationErrors is every problem found in the scenarios
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
@@ -0,0 +1,89 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// RunDirLayout is the timestamp format used to name run directories
+const RunDirLayout = "20060102-150405"
+
+// unsafePath matches anything that should not end up in a directory name
+var unsafePath = regexp.MustCompile(`[^A-Za-z0-9._@-]+`)
+
+// NewRunDir creates a directory for a run under parent named after
+// the time the run started. If a run already used that name, such as
+// when two runs start within a second, a counter is added
+func NewRunDir(parent string, start time.Time) (string, error) {
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", err
+	}
+	base := filepath.Join(parent, start.Format(RunDirLayout))
+	dir := base
+	for i := 2; ; i++ {
+		err := os.Mkdir(dir, 0755)
+		if err == nil {
+			return dir, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", err
+		}
+		dir = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// SessionDir is where the output of a session is written, relative to the run directory.
+// Sessions launched more than once, such as in a soak, get a directory per launch
+func SessionDir(session int, user string, launch int) string {
+	name := fmt.Sprintf("%d-%s", session, unsafePath.ReplaceAllString(user, "_"))
+	if launch > 1 {
+		name = fmt.Sprintf("%s-%d", name, launch)
+	}
+	return filepath.Join("sessions", name)
+}
+
+// Capture is the files a session's stdout and stderr are written to.
+// Output is written a line at a time so secrets can be masked
+type Capture struct {
+	Dir    string
+	Stdout *LineWriter
+	Stderr *LineWriter
+	files  []*os.File
+}
+
+// NewCapture creates dir with a stdout.log and stderr.log in it
+func NewCapture(dir string) (*Capture, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	stdout, err := os.Create(filepath.Join(dir, "stdout.log"))
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := os.Create(filepath.Join(dir, "stderr.log"))
+	if err != nil {
+		stdout.Close()
+		return nil, err
+	}
+	return &Capture{
+		Dir:    dir,
+		Stdout: NewLineWriter(stdout),
+		Stderr: NewLineWriter(stderr),
+		files:  []*os.File{stdout, stderr},
+	}, nil
+}
+
+// Close writes out any partial lines and closes both files
+func (c *Capture) Close() error {
+	var firstErr error
+	for _, err := range []error{c.Stdout.Flush(), c.Stderr.Flush(), c.files[0].Close(), c.files[1].Close()} {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
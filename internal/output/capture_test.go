@@ -0,0 +1,50 @@
+package output_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dpastoor/plr/internal/output"
+	"github.com/metrumresearchgroup/wrapt"
+)
+
+func TestNewRunDir(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	parent := filepath.Join(tt.TempDir(), "runs")
+	start := time.Date(2022, 7, 1, 12, 30, 5, 0, time.UTC)
+	first, err := output.NewRunDir(parent, start)
+	t.R.NoError(err)
+	t.A.Equal(filepath.Join(parent, "20220701-123005"), first)
+	second, err := output.NewRunDir(parent, start)
+	t.R.NoError(err)
+	t.A.Equal(filepath.Join(parent, "20220701-123005-2"), second)
+	t.A.DirExists(second)
+}
+
+func TestSessionDir(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	t.A.Equal(filepath.Join("sessions", "3-user1"), output.SessionDir(3, "user1", 1))
+	t.A.Equal(filepath.Join("sessions", "3-user1-2"), output.SessionDir(3, "user1", 2))
+	t.A.Equal(filepath.Join("sessions", "12-domain_jane.doe@corp"), output.SessionDir(12, `domain\jane.doe@corp`, 1))
+	t.A.Equal(filepath.Join("sessions", "1-.._x"), output.SessionDir(1, "../x", 1))
+}
+
+func TestCapture(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	dir := filepath.Join(tt.TempDir(), "sessions", "1-user1")
+	c, err := output.NewCapture(dir)
+	t.R.NoError(err)
+	_, err = c.Stdout.Write([]byte("out\n"))
+	t.R.NoError(err)
+	_, err = c.Stderr.Write([]byte("partial"))
+	t.R.NoError(err)
+	t.R.NoError(c.Close())
+	stdout, err := os.ReadFile(filepath.Join(dir, "stdout.log"))
+	t.R.NoError(err)
+	t.A.Equal("out\n", string(stdout))
+	stderr, err := os.ReadFile(filepath.Join(dir, "stderr.log"))
+	t.R.NoError(err)
+	t.A.Equal("partial\n", string(stderr), "partial lines are written on close")
+}
@@ -0,0 +1,158 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/dpastoor/plr/internal/redact"
+)
+
+// maxLineLen is how much of a line is held back waiting for its end,
+// longer lines are written out as several lines
+const maxLineLen = 64 * 1024
+
+// LineWriter writes whole lines to w, each starting with prefix and with
+// secrets masked. Partial lines are held until the rest of the line arrives,
+// so lines from writers sharing a lock never tear.
+// A single LineWriter should only be written to by one goroutine
+type LineWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+// NewLineWriter returns a LineWriter to w without a prefix
+func NewLineWriter(w io.Writer) *LineWriter {
+	return &LineWriter{mu: &sync.Mutex{}, w: w}
+}
+
+func (lw *LineWriter) Write(p []byte) (int, error) {
+	lw.buf = append(lw.buf, p...)
+	var out bytes.Buffer
+	for {
+		i := bytes.IndexByte(lw.buf, '\n')
+		if i < 0 {
+			if !lw.splitLong(&out) {
+				break
+			}
+			continue
+		}
+		lw.appendLine(&out, lw.buf[:i+1])
+		lw.buf = lw.buf[i+1:]
+	}
+	if out.Len() > 0 {
+		if err := lw.write(out.Bytes()); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// splitLong writes out the first maxLineLen bytes of a held line that grew
+// too long as a line of its own, and returns whether it did. Secrets are
+// masked in the whole held line first, and it is only split once enough
+// is held past the cut that a secret crossing it is whole and so masked
+func (lw *LineWriter) splitLong(out *bytes.Buffer) bool {
+	if len(lw.buf) < maxLineLen {
+		return false
+	}
+	lw.buf = redact.Bytes(lw.buf)
+	if len(lw.buf) < maxLineLen+redact.MaxLen() {
+		return false
+	}
+	lw.appendLine(out, append(lw.buf[:maxLineLen:maxLineLen], '\n'))
+	lw.buf = lw.buf[maxLineLen:]
+	return true
+}
+
+// Flush writes out any partial line left, ending it with a newline
+func (lw *LineWriter) Flush() error {
+	if len(lw.buf) == 0 {
+		return nil
+	}
+	var out bytes.Buffer
+	lw.appendLine(&out, append(lw.buf, '\n'))
+	lw.buf = nil
+	return lw.write(out.Bytes())
+}
+
+func (lw *LineWriter) appendLine(out *bytes.Buffer, line []byte) {
+	out.WriteString(lw.prefix)
+	out.Write(redact.Bytes(line))
+}
+
+func (lw *LineWriter) write(b []byte) error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	_, err := lw.w.Write(b)
+	return err
+}
+
+// palette are the ansi colors prefixes cycle through, skipping red
+// so it is not mistaken for errors
+var palette = []string{"\x1b[36m", "\x1b[33m", "\x1b[32m", "\x1b[35m", "\x1b[34m", "\x1b[96m", "\x1b[93m", "\x1b[92m", "\x1b[95m", "\x1b[94m"}
+
+const colorReset = "\x1b[0m"
+
+// Mux multiplexes the output of many sessions onto one writer,
+// prefixing every line with the session and stream it came from
+type Mux struct {
+	mu    sync.Mutex
+	w     io.Writer
+	color bool
+}
+
+func NewMux(w io.Writer, color bool) *Mux {
+	return &Mux{w: w, color: color}
+}
+
+// Writer returns a LineWriter for one stream of a session, such as stdout or stderr
+func (m *Mux) Writer(session int, user string, stream string) *LineWriter {
+	prefix := fmt.Sprintf("%d %s %s | ", session, user, stream)
+	if m.color {
+		prefix = palette[session%len(palette)] + prefix + colorReset
+	}
+	return &LineWriter{mu: &m.mu, w: m.w, prefix: prefix}
+}
+
+// Println writes a line that is not from a session, such as a status line,
+// with secrets masked and without tearing any session lines
+func (m *Mux) Println(line string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := fmt.Fprintln(m.w, redact.String(line))
+	return err
+}
+
+// Color settings for prefixed output
+const (
+	ColorAuto   = "auto"
+	ColorAlways = "always"
+	ColorNever  = "never"
+)
+
+// UseColor decides whether to colorize output to f. With ColorAuto colors
+// are used when f is a terminal and the NO_COLOR environment variable is not set
+func UseColor(setting string, f *os.File) (bool, error) {
+	switch setting {
+	case ColorAlways:
+		return true, nil
+	case ColorNever:
+		return false, nil
+	case ColorAuto:
+		if _, ok := os.LookupEnv("NO_COLOR"); ok {
+			return false, nil
+		}
+		info, err := f.Stat()
+		if err != nil {
+			return false, nil
+		}
+		return info.Mode()&os.ModeCharDevice != 0, nil
+	default:
+		return false, fmt.Errorf("unknown color setting %q, must be auto, always or never", setting)
+	}
+}
@@ -0,0 +1,119 @@
+package output_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dpastoor/plr/internal/output"
+	"github.com/dpastoor/plr/internal/redact"
+	"github.com/metrumresearchgroup/wrapt"
+	"github.com/samber/lo"
+)
+
+func TestLineWriterHoldsPartialLines(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	var buf bytes.Buffer
+	w := output.NewLineWriter(&buf)
+	fmt.Fprint(w, "first ")
+	t.A.Equal("", buf.String())
+	fmt.Fprint(w, "line\nsecond line\nthi")
+	t.A.Equal("first line\nsecond line\n", buf.String())
+	t.R.NoError(w.Flush())
+	t.A.Equal("first line\nsecond line\nthi\n", buf.String())
+}
+
+func TestLineWriterMasksSecretsSplitAcrossWrites(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	redact.Add("line-writer-secret")
+	tt.Cleanup(func() { redact.Remove("line-writer-secret") })
+	var buf bytes.Buffer
+	w := output.NewLineWriter(&buf)
+	fmt.Fprint(w, "password is line-wri")
+	fmt.Fprint(w, "ter-secret\n")
+	t.A.Equal("password is "+redact.Mask+"\n", buf.String())
+}
+
+func TestLineWriterSplitsLongLines(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	redact.Add("long-line-secret")
+	tt.Cleanup(func() { redact.Remove("long-line-secret") })
+	// the secret straddles the 64KiB cut
+	line := strings.Repeat("a", 64*1024-5) + "long-line-secret" + strings.Repeat("b", 100)
+	var buf bytes.Buffer
+	w := output.NewMux(&buf, false).Writer(1, "user1", "stdout")
+	for rest := line; len(rest) > 0; {
+		n := lo.Min([]int{1000, len(rest)})
+		fmt.Fprint(w, rest[:n])
+		rest = rest[n:]
+	}
+	fmt.Fprint(w, "\n")
+	t.A.NotContains(buf.String(), "long-line")
+	lines := strings.SplitAfter(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	t.R.Len(lines, 2)
+	for _, l := range lines {
+		t.A.True(strings.HasPrefix(l, "1 user1 stdout | "), l[:20])
+	}
+	got := strings.ReplaceAll(strings.ReplaceAll(buf.String(), "1 user1 stdout | ", ""), "\n", "")
+	t.A.Equal(redact.String(line), got)
+}
+
+func TestMuxPrefixesWholeLines(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	var buf bytes.Buffer
+	mux := output.NewMux(&buf, false)
+	var wg sync.WaitGroup
+	for session := 1; session <= 4; session++ {
+		wg.Add(1)
+		go func(session int) {
+			defer wg.Done()
+			w := mux.Writer(session, "user1", "stdout")
+			for i := 0; i < 100; i++ {
+				// write each line in two pieces to give other sessions a chance to tear it
+				fmt.Fprintf(w, "session %d ", session)
+				fmt.Fprintf(w, "line %d\n", i)
+			}
+		}(session)
+	}
+	wg.Wait()
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	t.R.Len(lines, 400)
+	for _, line := range lines {
+		var prefixed, own, i int
+		_, err := fmt.Sscanf(line, "%d user1 stdout | session %d line %d", &prefixed, &own, &i)
+		t.R.NoError(err, line)
+		t.A.Equal(prefixed, own, line)
+	}
+}
+
+func TestMuxPrintlnMasksSecrets(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	redact.Add("mux-println-secret")
+	tt.Cleanup(func() { redact.Remove("mux-println-secret") })
+	var buf bytes.Buffer
+	t.R.NoError(output.NewMux(&buf, false).Println("[failed] session 1 mux-println-secret"))
+	t.A.Equal("[failed] session 1 "+redact.Mask+"\n", buf.String())
+}
+
+func TestMuxColor(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	var buf bytes.Buffer
+	w := output.NewMux(&buf, true).Writer(2, "user1", "stderr")
+	fmt.Fprint(w, "hello\n")
+	t.A.True(strings.HasPrefix(buf.String(), "\x1b["))
+	t.A.Contains(buf.String(), "2 user1 stderr | \x1b[0mhello\n")
+}
+
+func TestUseColor(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	color, err := output.UseColor(output.ColorAlways, nil)
+	t.R.NoError(err)
+	t.A.True(color)
+	color, err = output.UseColor(output.ColorNever, nil)
+	t.R.NoError(err)
+	t.A.False(color)
+	_, err = output.UseColor("sometimes", nil)
+	t.A.Error(err)
+}
@@ -0,0 +1,27 @@
+package output
+
+import "fmt"
+
+// Mode is how the output of sessions reaches the terminal.
+// Output is always written to files in the run directory as well
+type Mode string
+
+const (
+	// ModeCapture only writes session output to files, showing a status line per session instead
+	ModeCapture Mode = "capture"
+	// ModeLive also passes session output through to the terminal as is
+	ModeLive Mode = "live"
+	// ModePrefixed also passes session output through to the terminal a line at a time,
+	// with each line prefixed by the session, user and stream it came from
+	ModePrefixed Mode = "prefixed"
+)
+
+// ParseMode checks the output mode is one plr knows about
+func ParseMode(mode string) (Mode, error) {
+	switch m := Mode(mode); m {
+	case ModeCapture, ModeLive, ModePrefixed:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown output mode %q, must be capture, live or prefixed", mode)
+	}
+}
@@ -0,0 +1,47 @@
+package reader
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ReadRecords reads a csv file with a header row and returns each row
+// as a map of column name to value. Column names are trimmed and lower cased.
+func ReadRecords(path string) ([]map[string]string, error) {
+	inFile, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer inFile.Close()
+	r := csv.NewReader(inFile)
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%s has no header row", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, column := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(column))
+	}
+	var records []map[string]string
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return records, err
+		}
+		record := make(map[string]string, len(header))
+		for i, column := range header {
+			record[column] = row[i]
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
@@ -0,0 +1,143 @@
+package redact
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Mask replaces every secret in redacted output
+const Mask = "********"
+
+var (
+	mu       sync.RWMutex
+	secrets  = make(map[string]struct{})
+	replacer = strings.NewReplacer()
+	// longest is the length of the longest secret
+	longest int
+)
+
+// Add registers secrets that should be masked in all output.
+// Quoted and JSON escaped forms of each secret are registered as well
+// so they are still caught when printed with %q or encoded as JSON
+func Add(values ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, value := range values {
+		for _, form := range forms(value) {
+			secrets[form] = struct{}{}
+		}
+	}
+	rebuild()
+}
+
+// Remove stops masking secrets registered with Add, such as
+// when a test cleans up the secrets it registered
+func Remove(values ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, value := range values {
+		for _, form := range forms(value) {
+			delete(secrets, form)
+		}
+	}
+	rebuild()
+}
+
+// forms returns the forms of value that are masked
+func forms(value string) []string {
+	if value == "" {
+		return nil
+	}
+	forms := []string{value, strings.Trim(strconv.Quote(value), `"`)}
+	if b, err := json.Marshal(value); err == nil {
+		forms = append(forms, strings.Trim(string(b), `"`))
+	}
+	return forms
+}
+
+// rebuild replaces the replacer with one for the current secrets,
+// mu must be held
+func rebuild() {
+	// longest first so a secret that contains another secret is fully masked
+	all := make([]string, 0, len(secrets))
+	for secret := range secrets {
+		all = append(all, secret)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if len(all[i]) != len(all[j]) {
+			return len(all[i]) > len(all[j])
+		}
+		return all[i] < all[j]
+	})
+	longest = 0
+	if len(all) > 0 {
+		longest = len(all[0])
+	}
+	pairs := make([]string, 0, 2*len(all))
+	for _, secret := range all {
+		pairs = append(pairs, secret, Mask)
+	}
+	replacer = strings.NewReplacer(pairs...)
+}
+
+// String masks all registered secrets in s
+func String(s string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return replacer.Replace(s)
+}
+
+// MaxLen returns the length of the longest registered secret, or 0 if there are none
+func MaxLen() int {
+	mu.RLock()
+	defer mu.RUnlock()
+	return longest
+}
+
+// Bytes masks all registered secrets in b
+func Bytes(b []byte) []byte {
+	return []byte(String(string(b)))
+}
+
+type writer struct {
+	w io.Writer
+}
+
+// Writer wraps w so every write is masked.
+// Each write is masked on its own, so it should only be used
+// for writers that receive whole messages such as log lines
+func Writer(w io.Writer) io.Writer {
+	return &writer{w: w}
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if _, err := w.w.Write(Bytes(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Formatter wraps a logrus formatter to mask secrets in
+// both the message and fields of every entry
+type Formatter struct {
+	log.Formatter
+}
+
+// NewFormatter wraps f so its output is masked
+func NewFormatter(f log.Formatter) *Formatter {
+	return &Formatter{Formatter: f}
+}
+
+func (f *Formatter) Format(entry *log.Entry) ([]byte, error) {
+	b, err := f.Formatter.Format(entry)
+	if err != nil {
+		return b, err
+	}
+	return Bytes(b), nil
+}
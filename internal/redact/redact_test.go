@@ -0,0 +1,79 @@
+package redact_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/dpastoor/plr/internal/redact"
+	"github.com/metrumresearchgroup/wrapt"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestRedact(tt *testing.T) {
+	redact.Add("hunter2", `pa"ss<word>`, "hunter2-admin")
+	tt.Cleanup(func() { redact.Remove("hunter2", `pa"ss<word>`, "hunter2-admin") })
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "plain",
+			in:   "--password=hunter2",
+			want: "--password=" + redact.Mask,
+		},
+		{
+			name: "longest secret first",
+			in:   "hunter2-admin",
+			want: redact.Mask,
+		},
+		{
+			name: "quoted",
+			in:   fmt.Sprintf("%q", `pa"ss<word>`),
+			want: `"` + redact.Mask + `"`,
+		},
+		{
+			name: "json",
+			in: func() string {
+				b, _ := json.Marshal(`pa"ss<word>`)
+				return string(b)
+			}(),
+			want: `"` + redact.Mask + `"`,
+		},
+		{
+			name: "no secrets",
+			in:   "nothing to see here",
+			want: "nothing to see here",
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+			t.A.Equal(test.want, redact.String(test.in))
+		})
+	}
+}
+
+func TestFormatter(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	redact.Add("hunter2")
+	tt.Cleanup(func() { redact.Remove("hunter2") })
+	var buf bytes.Buffer
+	logger := log.New()
+	logger.SetOutput(&buf)
+	logger.SetFormatter(redact.NewFormatter(&log.TextFormatter{DisableTimestamp: true}))
+	logger.WithField("opts", "password=hunter2").Info("failed with hunter2")
+	t.A.NotContains(buf.String(), "hunter2")
+	t.A.Contains(buf.String(), redact.Mask)
+}
+
+func TestRemove(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	redact.Add("removed-secret", "kept-secret")
+	tt.Cleanup(func() { redact.Remove("kept-secret") })
+	redact.Remove("removed-secret")
+	t.A.Equal("removed-secret "+redact.Mask, redact.String("removed-secret kept-secret"))
+	t.A.Equal(`"removed-secret"`, redact.String(fmt.Sprintf("%q", "removed-secret")))
+}
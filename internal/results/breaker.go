@@ -0,0 +1,61 @@
+package results
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/dpastoor/plr/internal/config"
+)
+
+// Breaker watches a rolling window of session outcomes and trips once
+// too many of them are failures or timeouts. Sessions that were stopped
+// or never started say nothing about the server so they are not counted
+type Breaker struct {
+	cfg config.CircuitBreaker
+
+	mu sync.Mutex
+	// window holds whether each of the most recent outcomes was a failure
+	window  []bool
+	tripped bool
+}
+
+func NewBreaker(cfg config.CircuitBreaker) *Breaker {
+	return &Breaker{cfg: cfg, window: make([]bool, 0, cfg.Window)}
+}
+
+// Observe adds the outcome of a session to the window. The first time
+// the breaker trips it returns why, afterwards it always returns ""
+func (b *Breaker) Observe(reason Reason) string {
+	var failed bool
+	switch reason {
+	case Completed:
+	case Failed, TimedOut:
+		failed = true
+	default:
+		return ""
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tripped {
+		return ""
+	}
+	if len(b.window) == b.cfg.Window {
+		b.window = b.window[1:]
+	}
+	b.window = append(b.window, failed)
+	failures := 0
+	for _, f := range b.window {
+		if f {
+			failures++
+		}
+	}
+	switch {
+	case b.cfg.MaxFailures > 0 && failures >= b.cfg.MaxFailures:
+		b.tripped = true
+		return fmt.Sprintf("%d of the last %d sessions failed or timed out, reaching the limit of %d", failures, len(b.window), b.cfg.MaxFailures)
+	case b.cfg.MaxFailureRatio > 0 && len(b.window) == b.cfg.Window && float64(failures)/float64(len(b.window)) >= b.cfg.MaxFailureRatio:
+		b.tripped = true
+		return fmt.Sprintf("%d of the last %d sessions failed or timed out, reaching the limit of %.0f%%", failures, len(b.window), b.cfg.MaxFailureRatio*100)
+	}
+	return ""
+}
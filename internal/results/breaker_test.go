@@ -0,0 +1,47 @@
+package results_test
+
+import (
+	"testing"
+
+	"github.com/dpastoor/plr/internal/config"
+	"github.com/dpastoor/plr/internal/results"
+	"github.com/metrumresearchgroup/wrapt"
+)
+
+// observe feeds outcomes to the breaker and returns the index of the one that tripped it, or -1
+func observe(b *results.Breaker, outcomes ...results.Reason) (int, string) {
+	for i, o := range outcomes {
+		if reason := b.Observe(o); reason != "" {
+			return i, reason
+		}
+	}
+	return -1, ""
+}
+
+func TestBreakerMaxFailures(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	b := results.NewBreaker(config.CircuitBreaker{Window: 3, MaxFailures: 2})
+	ok, fail := results.Completed, results.Failed
+	// failures drop out of the window before a second one arrives
+	i, _ := observe(b, fail, ok, ok, results.TimedOut, ok, ok)
+	t.A.Equal(-1, i)
+	i, reason := observe(b, fail, results.NotStarted, results.Stopped, fail)
+	t.A.Equal(3, i)
+	t.A.Equal("2 of the last 3 sessions failed or timed out, reaching the limit of 2", reason)
+	i, _ = observe(b, fail, fail)
+	t.A.Equal(-1, i, "only trips once")
+}
+
+func TestBreakerMaxFailureRatio(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	b := results.NewBreaker(config.CircuitBreaker{Window: 4, MaxFailureRatio: 0.5})
+	ok, fail := results.Completed, results.Failed
+	// the ratio is only checked once the window is full
+	i, reason := observe(b, fail, fail, ok, ok)
+	t.A.Equal(3, i)
+	t.A.Equal("2 of the last 4 sessions failed or timed out, reaching the limit of 50%", reason)
+
+	b = results.NewBreaker(config.CircuitBreaker{Window: 4, MaxFailureRatio: 0.5})
+	i, _ = observe(b, fail, ok, ok, ok, ok, fail, ok)
+	t.A.Equal(-1, i)
+}
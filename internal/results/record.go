@@ -0,0 +1,126 @@
+package results
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dpastoor/plr/internal/runner"
+)
+
+// Reason is why a session ended
+type Reason string
+
+const (
+	Completed Reason = "completed"
+	Failed    Reason = "failed"
+	TimedOut  Reason = "timeout"
+	// Stopped sessions were asked to stop because the run was interrupted
+	Stopped Reason = "stopped"
+	Killed  Reason = "killed"
+	// NotStarted sessions were queued but the run ended before they launched
+	NotStarted Reason = "not_started"
+)
+
+// Reasons are all the reasons a session can end
+var Reasons = []Reason{Completed, Failed, TimedOut, Stopped, Killed, NotStarted}
+
+// ParseReason checks that s is one of Reasons
+func ParseReason(s string) (Reason, error) {
+	for _, r := range Reasons {
+		if string(r) == s {
+			return r, nil
+		}
+	}
+	return "", fmt.Errorf("unknown session outcome %q, must be one of %v", s, Reasons)
+}
+
+// Count returns how many records ended for one of the given reasons
+func Count(records []Record, reasons ...Reason) int {
+	n := 0
+	for _, r := range records {
+		for _, reason := range reasons {
+			if r.Reason == reason {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
+
+// Record is the outcome of a single session.
+// Durations are in seconds so they load as plain numbers,
+// and times are nil when the session never got that far
+type Record struct {
+	// Session is the 1-indexed position of the session in the scenarios
+	Session      int              `json:"session"`
+	User         string           `json:"user"`
+	SessionName  string           `json:"session_name"`
+	Script       string           `json:"script"`
+	PlannedDelay float64          `json:"planned_delay"`
+	SlotWait     float64          `json:"slot_wait"`
+	LaunchedAt   *time.Time       `json:"launched_at"`
+	EndedAt      *time.Time       `json:"ended_at"`
+	Duration     float64          `json:"duration"`
+	ExitCode     *int             `json:"exit_code"`
+	Reason       Reason           `json:"reason"`
+	Error        string           `json:"error"`
+	Leftovers    []runner.Process `json:"leftovers,omitempty"`
+	// OutputDir holds the stdout and stderr of the session
+	OutputDir string `json:"output_dir,omitempty"`
+}
+
+// Launched marks the session as launched at t
+func (r *Record) Launched(t time.Time) {
+	r.LaunchedAt = &t
+}
+
+// Ended marks the session as ended at t with the given exit code,
+// where a negative exit code means the script did not exit on its own
+func (r *Record) Ended(t time.Time, exitCode int) {
+	r.EndedAt = &t
+	if r.LaunchedAt != nil {
+		r.Duration = t.Sub(*r.LaunchedAt).Seconds()
+	}
+	if exitCode >= 0 {
+		r.ExitCode = &exitCode
+	}
+}
+
+// Collector gathers records from concurrently running sessions
+type Collector struct {
+	mu      sync.Mutex
+	records []Record
+}
+
+func NewCollector() *Collector {
+	return &Collector{}
+}
+
+// Add adds the record of a finished session
+func (c *Collector) Add(r Record) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.records = append(c.records, r)
+}
+
+// Records returns the records ordered by session, and by launch time
+// for sessions that ran more than once, with sessions that never launched last
+func (c *Collector) Records() []Record {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	records := append([]Record(nil), c.records...)
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.Session != b.Session {
+			return a.Session < b.Session
+		}
+		if a.LaunchedAt == nil || b.LaunchedAt == nil {
+			return b.LaunchedAt == nil && a.LaunchedAt != nil
+		}
+		return a.LaunchedAt.Before(*b.LaunchedAt)
+	})
+	return records
+}
@@ -0,0 +1,108 @@
+package results_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dpastoor/plr/internal/reader"
+	"github.com/dpastoor/plr/internal/results"
+	"github.com/dpastoor/plr/internal/runner"
+	"github.com/metrumresearchgroup/wrapt"
+)
+
+func testRecords() []results.Record {
+	launched := time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)
+	completed := results.Record{Session: 2, User: "user1", Script: "run.py", PlannedDelay: 1.5, Reason: results.Completed}
+	completed.Launched(launched)
+	completed.Ended(launched.Add(90*time.Second), 0)
+	killed := results.Record{Session: 1, User: "user2", SessionName: "s1", Script: "run.py", Reason: results.Killed, Error: "force killed"}
+	killed.Launched(launched)
+	killed.Ended(launched.Add(time.Second), -1)
+	killed.Leftovers = []runner.Process{{Pid: 10, Name: "chrome"}, {Pid: 11}}
+	return []results.Record{
+		completed,
+		{Session: 3, User: "user1", Script: "run.py", Reason: results.NotStarted},
+		killed,
+	}
+}
+
+func TestRecordEnded(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	records := testRecords()
+	t.A.Equal(90.0, records[0].Duration)
+	t.R.NotNil(records[0].ExitCode)
+	t.A.Equal(0, *records[0].ExitCode)
+	t.A.Nil(records[2].ExitCode, "no exit code when ended by a signal")
+	t.A.Nil(records[1].LaunchedAt)
+}
+
+func TestCollectorOrder(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	c := results.NewCollector()
+	launched := time.Now()
+	later := results.Record{Session: 1, User: "later"}
+	later.Launched(launched.Add(time.Second))
+	earlier := results.Record{Session: 1, User: "earlier"}
+	earlier.Launched(launched)
+	c.Add(results.Record{Session: 1, User: "never"})
+	c.Add(results.Record{Session: 2, User: "second"})
+	c.Add(later)
+	c.Add(earlier)
+	var users []string
+	for _, r := range c.Records() {
+		users = append(users, r.User)
+	}
+	t.A.Equal([]string{"earlier", "later", "never", "second"}, users)
+}
+
+func TestWriteJSONLines(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	var buf bytes.Buffer
+	t.R.NoError(results.WriteJSONLines(&buf, testRecords()))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	t.R.Len(lines, 3)
+	var got map[string]interface{}
+	t.R.NoError(json.Unmarshal([]byte(lines[1]), &got))
+	t.A.Equal("not_started", got["reason"])
+	t.A.Nil(got["launched_at"])
+	t.A.Nil(got["exit_code"])
+	t.R.NoError(json.Unmarshal([]byte(lines[0]), &got))
+	t.A.Equal(90.0, got["duration"])
+	t.A.Equal(0.0, got["exit_code"])
+	t.A.Equal("2022-07-01T12:00:00Z", got["launched_at"])
+}
+
+func TestWriteFileCSV(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	path := filepath.Join(tt.TempDir(), "results.csv")
+	t.R.NoError(results.WriteFile(path, testRecords()))
+	rows, err := reader.ReadRecords(path)
+	t.R.NoError(err)
+	t.R.Len(rows, 3)
+	t.A.Equal("2", rows[0]["session"])
+	t.A.Equal("1.500", rows[0]["planned_delay"])
+	t.A.Equal("90.000", rows[0]["duration"])
+	t.A.Equal("0", rows[0]["exit_code"])
+	t.A.Equal("", rows[1]["launched_at"])
+	t.A.Equal("", rows[2]["exit_code"])
+	t.A.Equal("killed", rows[2]["reason"])
+	t.A.Equal("chrome (pid 10);pid 11", rows[2]["leftovers"])
+}
+
+func TestFormatFor(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	format, err := results.FormatFor("out/results.JSONL")
+	t.R.NoError(err)
+	t.A.Equal(results.JSONLines, format)
+	format, err = results.FormatFor("results.csv")
+	t.R.NoError(err)
+	t.A.Equal(results.CSV, format)
+	_, err = results.FormatFor("results.txt")
+	t.A.Error(err)
+	_, err = results.FormatFor("results.json")
+	t.A.ErrorContains(err, ".jsonl")
+}
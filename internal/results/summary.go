@@ -0,0 +1,211 @@
+package results
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Stats describes the durations, in seconds, of completed sessions
+type Stats struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// Summary counts the outcomes of a group of sessions.
+// Durations only cover completed sessions so failures that end
+// early and timeouts do not skew them, and is nil if none completed
+type Summary struct {
+	User        string `json:"user,omitempty"`
+	SessionName string `json:"session_name,omitempty"`
+	Script      string `json:"script,omitempty"`
+	Total       int    `json:"total"`
+	Completed   int    `json:"completed"`
+	Failed      int    `json:"failed"`
+	TimedOut    int    `json:"timeout"`
+	// Stopped includes sessions that were killed
+	Stopped    int    `json:"stopped"`
+	NotStarted int    `json:"not_started"`
+	Durations  *Stats `json:"durations"`
+}
+
+// Report is the summary of a whole run, by group and overall
+type Report struct {
+	Groups     []Summary         `json:"groups"`
+	Total      Summary           `json:"total"`
+	Thresholds []ThresholdResult `json:"thresholds,omitempty"`
+	// Aborted is why the circuit breaker aborted the run, if it did
+	Aborted string `json:"aborted,omitempty"`
+}
+
+type groupKey struct {
+	user, sessionName, script string
+}
+
+// Summarize groups the records by user, session name and script
+func Summarize(records []Record) Report {
+	groups := make(map[groupKey][]Record)
+	for _, r := range records {
+		key := groupKey{r.User, r.SessionName, r.Script}
+		groups[key] = append(groups[key], r)
+	}
+	report := Report{Total: summarize(records)}
+	for key, group := range groups {
+		s := summarize(group)
+		s.User, s.SessionName, s.Script = key.user, key.sessionName, key.script
+		report.Groups = append(report.Groups, s)
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		a, b := report.Groups[i], report.Groups[j]
+		if a.User != b.User {
+			return a.User < b.User
+		}
+		if a.SessionName != b.SessionName {
+			return a.SessionName < b.SessionName
+		}
+		return a.Script < b.Script
+	})
+	return report
+}
+
+func summarize(records []Record) Summary {
+	s := Summary{Total: len(records)}
+	var durations []float64
+	for _, r := range records {
+		switch r.Reason {
+		case Completed:
+			s.Completed++
+			durations = append(durations, r.Duration)
+		case TimedOut:
+			s.TimedOut++
+		case Stopped, Killed:
+			s.Stopped++
+		case NotStarted:
+			s.NotStarted++
+		default:
+			s.Failed++
+		}
+	}
+	if len(durations) > 0 {
+		stats := newStats(durations)
+		s.Durations = &stats
+	}
+	return s
+}
+
+func newStats(durations []float64) Stats {
+	sorted := append([]float64(nil), durations...)
+	sort.Float64s(sorted)
+	var sum float64
+	for _, d := range sorted {
+		sum += d
+	}
+	return Stats{
+		Min:  sorted[0],
+		Mean: sum / float64(len(sorted)),
+		P50:  Percentile(sorted, 50),
+		P90:  Percentile(sorted, 90),
+		P95:  Percentile(sorted, 95),
+		P99:  Percentile(sorted, 99),
+		Max:  sorted[len(sorted)-1],
+	}
+}
+
+// Percentile returns the p-th percentile of sorted values using the
+// nearest-rank method, so the result is always one of the values
+func Percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// WriteTable writes the report as an aligned table, one row per group followed by the total
+func WriteTable(w io.Writer, report Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "USER\tSESSION\tSCRIPT\tTOTAL\tOK\tFAILED\tTIMEOUT\tSTOPPED\tNOT STARTED\tMIN\tMEAN\tP50\tP90\tP95\tP99\tMAX")
+	for _, s := range report.Groups {
+		writeRow(tw, s)
+	}
+	total := report.Total
+	total.User = "all"
+	writeRow(tw, total)
+	if len(report.Thresholds) > 0 {
+		fmt.Fprintln(tw, "\nTHRESHOLD\tACTUAL\tRESULT")
+		for _, t := range report.Thresholds {
+			result := "passed"
+			if !t.Passed {
+				result = "BREACHED"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", t.Threshold, dash(t.Actual), result)
+		}
+	}
+	if report.Aborted != "" {
+		fmt.Fprintf(tw, "\nrun aborted: %s\n", report.Aborted)
+	}
+	return tw.Flush()
+}
+
+func writeRow(w io.Writer, s Summary) {
+	durations := strings.Repeat("\t-", 7)
+	if d := s.Durations; d != nil {
+		durations = ""
+		for _, v := range []float64{d.Min, d.Mean, d.P50, d.P90, d.P95, d.P99, d.Max} {
+			durations += "\t" + formatDuration(v)
+		}
+	}
+	fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d%s\n",
+		dash(s.User), dash(s.SessionName), dash(s.Script),
+		s.Total, s.Completed, s.Failed, s.TimedOut, s.Stopped, s.NotStarted, durations)
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func formatDuration(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Millisecond).String()
+}
+
+// WriteReportFile writes the report to path as json if it ends in .json,
+// otherwise as the same table printed at the end of a run
+func WriteReportFile(path string, report Report) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else {
+		err = WriteTable(f, report)
+	}
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("could not write summary to %s: %w", path, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,82 @@
+package results_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dpastoor/plr/internal/results"
+	"github.com/metrumresearchgroup/wrapt"
+)
+
+func TestPercentile(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	var values []float64
+	for i := 1; i <= 100; i++ {
+		values = append(values, float64(i))
+	}
+	t.A.Equal(50.0, results.Percentile(values, 50))
+	t.A.Equal(95.0, results.Percentile(values, 95))
+	t.A.Equal(100.0, results.Percentile(values, 100))
+	t.A.Equal(1.0, results.Percentile(values, 0))
+	t.A.Equal(3.0, results.Percentile([]float64{1, 2, 3}, 90))
+	t.A.Equal(0.0, results.Percentile(nil, 50))
+}
+
+func completedIn(user string, seconds float64) results.Record {
+	r := results.Record{User: user, Script: "run.py", Reason: results.Completed}
+	launched := time.Now()
+	r.Launched(launched)
+	r.Ended(launched.Add(time.Duration(seconds*float64(time.Second))), 0)
+	return r
+}
+
+func TestSummarize(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	records := []results.Record{
+		completedIn("user2", 4),
+		completedIn("user1", 1),
+		completedIn("user1", 3),
+		{User: "user1", Script: "run.py", Reason: results.Failed},
+		{User: "user1", Script: "run.py", Reason: results.TimedOut},
+		{User: "user1", Script: "run.py", Reason: results.Killed},
+		{User: "user2", Script: "run.py", Reason: results.NotStarted},
+	}
+	report := results.Summarize(records)
+	t.R.Len(report.Groups, 2)
+	user1 := report.Groups[0]
+	t.A.Equal("user1", user1.User)
+	t.A.Equal(5, user1.Total)
+	t.A.Equal(2, user1.Completed)
+	t.A.Equal(1, user1.Failed)
+	t.A.Equal(1, user1.TimedOut)
+	t.A.Equal(1, user1.Stopped)
+	t.R.NotNil(user1.Durations)
+	t.A.InDelta(1, user1.Durations.Min, 0.001)
+	t.A.InDelta(2, user1.Durations.Mean, 0.001)
+	t.A.InDelta(3, user1.Durations.Max, 0.001)
+
+	t.A.Equal(7, report.Total.Total)
+	t.A.Equal(1, report.Total.NotStarted)
+	t.A.InDelta(4, report.Total.Durations.P99, 0.001)
+
+	none := results.Summarize([]results.Record{{User: "user1", Reason: results.Failed}})
+	t.A.Nil(none.Total.Durations)
+}
+
+func TestWriteTable(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	report := results.Summarize([]results.Record{
+		completedIn("user1", 90),
+		{User: "user2", Script: "run.py", Reason: results.Failed},
+	})
+	var buf bytes.Buffer
+	t.R.NoError(results.WriteTable(&buf, report))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	t.R.Len(lines, 4)
+	t.A.True(strings.HasPrefix(lines[0], "USER"))
+	t.A.Equal([]string{"user1", "-", "run.py", "1", "1", "0", "0", "0", "0", "1m30s"}, strings.Fields(lines[1])[:10])
+	t.A.Equal([]string{"user2", "-", "run.py", "1", "0", "1", "0", "0", "0", "-"}, strings.Fields(lines[2])[:10])
+	t.A.Equal("all", strings.Fields(lines[3])[0])
+}
@@ -0,0 +1,127 @@
+package results
+
+import (
+	"sort"
+	"time"
+
+	"github.com/dpastoor/plr/internal/config"
+)
+
+// ThresholdResult is the outcome of checking a threshold against a run
+type ThresholdResult struct {
+	Threshold string `json:"threshold"`
+	// Actual is the formatted value of the metric, empty if it could
+	// not be measured, such as durations when no session completed
+	Actual string `json:"actual"`
+	Passed bool   `json:"passed"`
+}
+
+// EvaluateThresholds checks every threshold against the records of the run.
+// A threshold whose metric could not be measured is breached
+func EvaluateThresholds(thresholds []config.Threshold, records []Record) []ThresholdResult {
+	total := summarize(records)
+	evaluated := make([]ThresholdResult, len(thresholds))
+	for i, t := range thresholds {
+		evaluated[i] = ThresholdResult{Threshold: t.String()}
+		actual, ok := metric(t.Metric, total, records)
+		if !ok {
+			continue
+		}
+		evaluated[i].Actual = t.Format(actual)
+		evaluated[i].Passed = t.Passes(actual)
+	}
+	return evaluated
+}
+
+// Breached returns the thresholds that did not pass
+func Breached(evaluated []ThresholdResult) []ThresholdResult {
+	var breached []ThresholdResult
+	for _, r := range evaluated {
+		if !r.Passed {
+			breached = append(breached, r)
+		}
+	}
+	return breached
+}
+
+// metric measures a threshold metric over the whole run.
+// Rates are out of the sessions that launched
+func metric(name string, total Summary, records []Record) (float64, bool) {
+	launched := float64(total.Total - total.NotStarted)
+	d := total.Durations
+	switch config.ThresholdMetrics[name] {
+	case config.DurationMetric:
+		if d == nil {
+			return 0, false
+		}
+	case config.RateMetric:
+		if launched == 0 {
+			return 0, false
+		}
+	}
+	switch name {
+	case "min_duration":
+		return d.Min, true
+	case "mean_duration":
+		return d.Mean, true
+	case "p50_duration":
+		return d.P50, true
+	case "p90_duration":
+		return d.P90, true
+	case "p95_duration":
+		return d.P95, true
+	case "p99_duration":
+		return d.P99, true
+	case "max_duration":
+		return d.Max, true
+	case "error_rate":
+		return float64(total.Failed+total.TimedOut) / launched, true
+	case "timeout_rate":
+		return float64(total.TimedOut) / launched, true
+	case "success_rate":
+		return float64(total.Completed) / launched, true
+	case "completed_count":
+		return float64(total.Completed), true
+	case "failed_count":
+		return float64(total.Failed), true
+	case "timeout_count":
+		return float64(total.TimedOut), true
+	case "stopped_count":
+		return float64(total.Stopped), true
+	case "not_started_count":
+		return float64(total.NotStarted), true
+	case "max_concurrent_reached":
+		return float64(MaxConcurrent(records)), true
+	}
+	return 0, false
+}
+
+// MaxConcurrent returns the largest number of sessions that were running at the same time
+func MaxConcurrent(records []Record) int {
+	type event struct {
+		at    time.Time
+		delta int
+	}
+	var events []event
+	for _, r := range records {
+		if r.LaunchedAt == nil || r.EndedAt == nil {
+			continue
+		}
+		events = append(events, event{*r.LaunchedAt, 1}, event{*r.EndedAt, -1})
+	}
+	// a session ending at the same moment another launches did not overlap with it
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].at.Equal(events[j].at) {
+			return events[i].delta < events[j].delta
+		}
+		return events[i].at.Before(events[j].at)
+	})
+	running, max := 0, 0
+	for _, e := range events {
+		running += e.delta
+		if running > max {
+			max = running
+		}
+	}
+	return max
+}
@@ -0,0 +1,63 @@
+package results_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dpastoor/plr/internal/config"
+	"github.com/dpastoor/plr/internal/results"
+	"github.com/metrumresearchgroup/wrapt"
+)
+
+func ranBetween(start time.Time, from, to int) results.Record {
+	r := results.Record{Reason: results.Completed}
+	r.Launched(start.Add(time.Duration(from) * time.Second))
+	r.Ended(start.Add(time.Duration(to)*time.Second), 0)
+	return r
+}
+
+func TestMaxConcurrent(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	start := time.Now()
+	records := []results.Record{
+		ranBetween(start, 0, 10),
+		ranBetween(start, 1, 5),
+		ranBetween(start, 2, 3),
+		// launches as the one above ends, so does not overlap with it
+		ranBetween(start, 3, 4),
+		ranBetween(start, 6, 8),
+		{Reason: results.NotStarted},
+	}
+	t.A.Equal(3, results.MaxConcurrent(records))
+	t.A.Equal(0, results.MaxConcurrent(nil))
+}
+
+func TestEvaluateThresholds(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	var thresholds []config.Threshold
+	for _, expr := range []string{"p95_duration < 90s", "error_rate < 10%", "max_concurrent_reached >= 2", "failed_count == 1"} {
+		th, err := config.ParseThreshold(expr)
+		t.R.NoError(err)
+		thresholds = append(thresholds, th)
+	}
+	start := time.Now()
+	records := []results.Record{
+		ranBetween(start, 0, 60),
+		ranBetween(start, 0, 100),
+		ranBetween(start, 0, 30),
+		{Reason: results.Failed},
+		{Reason: results.NotStarted},
+	}
+	evaluated := results.EvaluateThresholds(thresholds, records)
+	t.A.Equal([]results.ThresholdResult{
+		{Threshold: "p95_duration < 90s", Actual: "1m40s", Passed: false},
+		{Threshold: "error_rate < 10%", Actual: "25.00%", Passed: false},
+		{Threshold: "max_concurrent_reached >= 2", Actual: "3", Passed: true},
+		{Threshold: "failed_count == 1", Actual: "1", Passed: true},
+	}, evaluated)
+	t.A.Len(results.Breached(evaluated), 2)
+
+	unmeasured := results.EvaluateThresholds(thresholds[:1], []results.Record{{Reason: results.Failed}})
+	t.A.Equal("", unmeasured[0].Actual)
+	t.A.False(unmeasured[0].Passed)
+}
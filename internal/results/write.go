@@ -0,0 +1,127 @@
+package results
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format is the file format results are written in
+type Format string
+
+const (
+	JSONLines Format = "jsonl"
+	CSV       Format = "csv"
+)
+
+// csvHeader matches the json field names so both formats load the same way
+var csvHeader = []string{
+	"session", "user", "session_name", "script", "planned_delay", "slot_wait",
+	"launched_at", "ended_at", "duration", "exit_code", "reason", "error", "leftovers", "output_dir",
+}
+
+// FormatFor picks the format based on the extension of path.
+// .json is rejected rather than taken as JSON Lines, as json parsers
+// expect a single document in a .json file
+func FormatFor(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".ndjson":
+		return JSONLines, nil
+	case ".csv":
+		return CSV, nil
+	case ".json":
+		return "", fmt.Errorf("unsupported results file %s, results are written as JSON Lines so must end in .jsonl or .ndjson", path)
+	default:
+		return "", fmt.Errorf("unsupported results file %s, must end in .jsonl, .ndjson or .csv", path)
+	}
+}
+
+// WriteFile writes the records to path in the format matching its extension
+func WriteFile(path string, records []Record) error {
+	format, err := FormatFor(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if format == CSV {
+		err = WriteCSV(f, records)
+	} else {
+		err = WriteJSONLines(f, records)
+	}
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("could not write results to %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// WriteJSONLines writes one json object per record per line
+func WriteJSONLines(w io.Writer, records []Record) error {
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteCSV writes the records with a header row. Missing times and exit codes
+// are left empty and leftover processes are joined with a semicolon
+func WriteCSV(w io.Writer, records []Record) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, r := range records {
+		leftovers := make([]string, len(r.Leftovers))
+		for i, p := range r.Leftovers {
+			leftovers[i] = p.String()
+		}
+		exitCode := ""
+		if r.ExitCode != nil {
+			exitCode = strconv.Itoa(*r.ExitCode)
+		}
+		row := []string{
+			strconv.Itoa(r.Session),
+			r.User,
+			r.SessionName,
+			r.Script,
+			formatSeconds(r.PlannedDelay),
+			formatSeconds(r.SlotWait),
+			formatTime(r.LaunchedAt),
+			formatTime(r.EndedAt),
+			formatSeconds(r.Duration),
+			exitCode,
+			string(r.Reason),
+			r.Error,
+			strings.Join(leftovers, ";"),
+			r.OutputDir,
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatSeconds(s float64) string {
+	return strconv.FormatFloat(s, 'f', 3, 64)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
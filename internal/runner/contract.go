@@ -0,0 +1,51 @@
+package runner
+
+import "fmt"
+
+// ScriptContract is the version of the interface between plr and the script it runs
+type ScriptContract int
+
+const (
+	// ContractV1 passes everything, including the password, as command line flags.
+	// This leaves the password visible to anyone that can list processes on the host
+	// so should only be used for scripts that have not been updated to ContractV2
+	ContractV1 ScriptContract = 1
+	// ContractV2 passes the password through an environment variable or stdin.
+	// The script is told the contract version with --contract-version=2 and
+	// where to find the password with --password-from=<env|stdin>
+	ContractV2 ScriptContract = 2
+)
+
+// PasswordDelivery describes how the password is handed to a ContractV2 script
+type PasswordDelivery string
+
+const (
+	// PasswordFromEnv sets the password in the PasswordEnvVar environment variable
+	PasswordFromEnv PasswordDelivery = "env"
+	// PasswordFromStdin writes the password as the only line of stdin,
+	// any other stdin set for the script is not used
+	PasswordFromStdin PasswordDelivery = "stdin"
+)
+
+// PasswordEnvVar is the environment variable the password is set in for PasswordFromEnv
+const PasswordEnvVar = "PLR_PASSWORD"
+
+// ParseScriptContract checks the contract version is one plr knows about
+func ParseScriptContract(version int) (ScriptContract, error) {
+	switch c := ScriptContract(version); c {
+	case ContractV1, ContractV2:
+		return c, nil
+	default:
+		return 0, fmt.Errorf("unknown script contract version %d, must be 1 or 2", version)
+	}
+}
+
+// ParsePasswordDelivery checks the password delivery is one plr knows about
+func ParsePasswordDelivery(delivery string) (PasswordDelivery, error) {
+	switch d := PasswordDelivery(delivery); d {
+	case PasswordFromEnv, PasswordFromStdin:
+		return d, nil
+	default:
+		return "", fmt.Errorf("unknown password delivery %q, must be env or stdin", delivery)
+	}
+}
@@ -3,10 +3,15 @@ package runner
 import (
 	"io"
 	"os"
+	"time"
 
 	"github.com/dpastoor/plr/internal/config"
 )
 
+// DefaultKillGrace is how long a script gets to shut down
+// after being asked to stop before it is killed
+const DefaultKillGrace = 10 * time.Second
+
 type runOpts struct {
 	Id          string
 	SessionName string
@@ -18,15 +23,32 @@ type runOpts struct {
 	Memory     int
 	Image      string
 	PythonPath string
-	Stdin      io.ReadCloser
-	Stdout     io.Writer
-	Stderr     io.Writer
+	// Contract is the version of the script interface to use
+	Contract ScriptContract
+	// PasswordDelivery is how the password is handed to ContractV2 scripts
+	PasswordDelivery PasswordDelivery
+	// Timeout is how long the script may run for, 0 for no timeout
+	Timeout time.Duration
+	// KillGrace is how long the script has to exit after SIGTERM before it is killed
+	KillGrace time.Duration
+	// ForceKill kills the script without a grace period once closed
+	ForceKill <-chan struct{}
+	Stdin     io.ReadCloser
+	Stdout    io.Writer
+	Stderr    io.Writer
 }
 
 // NewRunOpts sets up the options for a runner with a default
-// configuration of creating a new session and wiring up to stdin, stdout, and stderr
+// configuration of creating a new session, passing the password through the environment
+// and wiring up to stdin, stdout, and stderr
 func NewDefaultRunOpts(options ...func(*runOpts)) *runOpts {
-	opts := &runOpts{NewSession: true, PythonPath: "python"}
+	opts := &runOpts{
+		NewSession:       true,
+		PythonPath:       "python",
+		Contract:         ContractV2,
+		PasswordDelivery: PasswordFromEnv,
+		KillGrace:        DefaultKillGrace,
+	}
 	opts.Apply(WithInteractiveIO())
 	for _, option := range options {
 		option(opts)
@@ -45,6 +67,42 @@ func WithPythonPath(pythonPath string) func(*runOpts) {
 	}
 }
 
+// WithScriptContract sets the version of the script interface
+func WithScriptContract(contract ScriptContract) func(*runOpts) {
+	return func(opts *runOpts) {
+		opts.Contract = contract
+	}
+}
+
+// WithPasswordDelivery sets how the password is handed to ContractV2 scripts
+func WithPasswordDelivery(delivery PasswordDelivery) func(*runOpts) {
+	return func(opts *runOpts) {
+		opts.PasswordDelivery = delivery
+	}
+}
+
+// WithTimeout sets how long the script may run for
+func WithTimeout(timeout time.Duration) func(*runOpts) {
+	return func(opts *runOpts) {
+		opts.Timeout = timeout
+	}
+}
+
+// WithKillGrace sets how long the script has to exit after being asked to stop
+func WithKillGrace(grace time.Duration) func(*runOpts) {
+	return func(opts *runOpts) {
+		opts.KillGrace = grace
+	}
+}
+
+// WithForceKill kills the script and its process group
+// straight away once force is closed
+func WithForceKill(force <-chan struct{}) func(*runOpts) {
+	return func(opts *runOpts) {
+		opts.ForceKill = force
+	}
+}
+
 // WithNcpu sets the number of cpus to use
 func WithNcpu(ncpu int) func(*runOpts) {
 	return func(opts *runOpts) {
@@ -165,5 +223,8 @@ func NewOptsFromSession(session config.Session) *runOpts {
 	if session.Id != nil && *session.Id != "" {
 		opts.Apply(WithId(*session.Id))
 	}
+	if session.Timeout != nil && *session.Timeout > 0 {
+		opts.Apply(WithTimeout(time.Duration(*session.Timeout * float64(time.Second))))
+	}
 	return opts
 }
@@ -0,0 +1,107 @@
+package runner
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// outputGrace is how long Run waits for the last of the script's output
+// to be copied once the script and its process group are gone
+const outputGrace = 5 * time.Second
+
+// outputPipes copies the script's stdout and stderr to their writers through
+// pipes owned by the runner, so Run can wait for every byte to be written
+// before it returns. Letting exec copy instead would make Wait block for as
+// long as anything left in the process group holds the pipes open
+type outputPipes struct {
+	// writeEnds are handed to the script and closed in the runner once it started
+	writeEnds []*os.File
+	readEnds  []*os.File
+	wg        sync.WaitGroup
+}
+
+// newOutputPipes returns what to set as the script's stdout and stderr.
+// Writers that are files, such as the terminal, are handed to the script
+// as is, while nil writers leave the stream discarded
+func newOutputPipes(stdout io.Writer, stderr io.Writer) (*outputPipes, io.Writer, io.Writer, error) {
+	p := &outputPipes{}
+	outW, err := p.pipe(stdout)
+	if err != nil {
+		p.closeAll()
+		return nil, nil, nil, err
+	}
+	errW, err := p.pipe(stderr)
+	if err != nil {
+		p.closeAll()
+		return nil, nil, nil, err
+	}
+	return p, outW, errW, nil
+}
+
+func (p *outputPipes) pipe(w io.Writer) (io.Writer, error) {
+	if w == nil {
+		return nil, nil
+	}
+	if f, ok := w.(*os.File); ok {
+		return f, nil
+	}
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	p.readEnds = append(p.readEnds, pr)
+	p.writeEnds = append(p.writeEnds, pw)
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		if _, err := io.Copy(w, pr); err != nil {
+			log.Debugf("could not copy script output: %s", err)
+			// keep draining so the script never blocks on a full pipe
+			io.Copy(io.Discard, pr)
+		}
+	}()
+	return pw, nil
+}
+
+// started closes the runner's copies of the write ends, so the copies
+// finish once every process holding the other copies has exited
+func (p *outputPipes) started() {
+	for _, f := range p.writeEnds {
+		f.Close()
+	}
+	p.writeEnds = nil
+}
+
+// wait waits until all output has been copied. If something outside the
+// process group still holds the pipes after outputGrace, the rest is dropped
+func (p *outputPipes) wait() {
+	p.started()
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	grace := time.NewTimer(outputGrace)
+	defer grace.Stop()
+	select {
+	case <-done:
+	case <-grace.C:
+		log.Warnf("script output still open %s after the script exited, dropping the rest", outputGrace)
+		for _, f := range p.readEnds {
+			f.Close()
+		}
+		<-done
+	}
+	p.closeAll()
+}
+
+func (p *outputPipes) closeAll() {
+	for _, f := range append(p.writeEnds, p.readEnds...) {
+		f.Close()
+	}
+	p.writeEnds, p.readEnds = nil, nil
+}
@@ -0,0 +1,45 @@
+//go:build linux
+
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// groupProcesses lists the processes still running in the process group by
+// reading /proc, ignoring zombies that are only waiting to be reaped
+func groupProcesses(pgid int) ([]Process, bool) {
+	stats, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil {
+		return nil, groupAlive(pgid)
+	}
+	var procs []Process
+	for _, stat := range stats {
+		contents, err := os.ReadFile(stat)
+		if err != nil {
+			// the process exited while we were looking
+			continue
+		}
+		// the command name is wrapped in parens and may itself contain spaces,
+		// so split the remaining fields after the last paren
+		line := string(contents)
+		open, end := strings.IndexByte(line, '('), strings.LastIndexByte(line, ')')
+		if open < 0 || end < open {
+			continue
+		}
+		fields := strings.Fields(line[end+1:])
+		// fields are state, ppid, pgrp, ...
+		if len(fields) < 3 || fields[0] == "Z" || fields[2] != strconv.Itoa(pgid) {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(line[:open]))
+		if err != nil {
+			continue
+		}
+		procs = append(procs, Process{Pid: pid, Name: line[open+1 : end]})
+	}
+	return procs, len(procs) > 0
+}
@@ -0,0 +1,33 @@
+//go:build !windows
+
+package runner
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts the command in its own process group so that
+// the browsers and drivers it spawns can be signalled together with it
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// terminateGroup asks every process in the group to shut down
+func terminateGroup(p *os.Process) error {
+	return syscall.Kill(-p.Pid, syscall.SIGTERM)
+}
+
+// killGroup forcefully kills every process in the group
+func killGroup(p *os.Process) error {
+	return syscall.Kill(-p.Pid, syscall.SIGKILL)
+}
+
+// groupAlive checks whether any process is left in the process group
+func groupAlive(pgid int) bool {
+	return syscall.Kill(-pgid, 0) == nil
+}
@@ -0,0 +1,34 @@
+//go:build windows
+
+package runner
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts the command in a new process group
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+// terminateGroup kills the process, windows has no equivalent
+// of SIGTERM for console processes so this can not be graceful
+func terminateGroup(p *os.Process) error {
+	return p.Kill()
+}
+
+// killGroup kills the process
+func killGroup(p *os.Process) error {
+	return p.Kill()
+}
+
+// groupProcesses is not supported on windows, where the process
+// is killed directly rather than through its group
+func groupProcesses(pgid int) ([]Process, bool) {
+	return nil, false
+}
@@ -0,0 +1,76 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// reapPoll is how often the process group is checked while waiting for it to exit
+const reapPoll = 100 * time.Millisecond
+
+// Process is a process left running in a script's process group
+type Process struct {
+	Pid  int    `json:"pid"`
+	Name string `json:"name,omitempty"`
+}
+
+func (p Process) String() string {
+	if p.Name == "" {
+		return fmt.Sprintf("pid %d", p.Pid)
+	}
+	return fmt.Sprintf("%s (pid %d)", p.Name, p.Pid)
+}
+
+// reapGroup stops anything the script left running in its process group,
+// such as browsers and drivers, once the script itself has exited.
+// The group is sent SIGTERM and then SIGKILL if it has not exited
+// after the kill grace period
+func (r *Runner) reapGroup() {
+	pgid := r.cmd.Process.Pid
+	procs, alive := groupProcesses(pgid)
+	if !alive {
+		return
+	}
+	r.leftovers = procs
+	if err := terminateGroup(r.cmd.Process); err != nil {
+		log.Debugf("could not terminate leftover process group %d: %s", pgid, err)
+	}
+	deadline := time.NewTimer(r.opts.KillGrace)
+	defer deadline.Stop()
+	poll := time.NewTicker(reapPoll)
+	defer poll.Stop()
+wait:
+	for alive {
+		select {
+		case <-r.opts.ForceKill:
+			break wait
+		case <-deadline.C:
+			break wait
+		case <-poll.C:
+			_, alive = groupProcesses(pgid)
+		}
+	}
+	if alive {
+		if err := killGroup(r.cmd.Process); err != nil {
+			log.Debugf("could not kill leftover process group %d: %s", pgid, err)
+		}
+	}
+	if len(procs) == 0 {
+		log.Warnf("stopped leftover processes in process group %d", pgid)
+		return
+	}
+	names := make([]string, len(procs))
+	for i, p := range procs {
+		names[i] = p.String()
+	}
+	log.Warnf("stopped %d leftover process(es) in process group %d: %s", len(procs), pgid, strings.Join(names, ", "))
+}
+
+// Leftovers returns the processes left running by the script after it
+// exited that had to be stopped, if they could be listed on this platform
+func (r *Runner) Leftovers() []Process {
+	return r.leftovers
+}
@@ -2,19 +2,35 @@ package runner
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/metrumresearchgroup/command"
 	"github.com/metrumresearchgroup/environ"
+	log "github.com/sirupsen/logrus"
 )
 
+// ErrTimeout is returned by Run when the script ran past the session
+// timeout or the deadline of the context it was created with
+var ErrTimeout = errors.New("timed out")
+
+// ErrKilled is returned by Run when the script was force killed
+var ErrKilled = errors.New("force killed")
+
 // Runner allows you to run commands
 type Runner struct {
+	ctx context.Context
 	cmd *command.Cmd
 	// might need to consider if want to be able to like reapply new options later or the like?
 	// right now thats not feasible since options get applied when constructing the command
 	// and don't want to prematurely overcomplicate things
 	opts *runOpts
+	// leftovers are processes found running in the process group after the script exited
+	leftovers []Process
+	// handshake is written to the script's stdin for PasswordFromStdin
+	handshake string
 }
 
 // NewRunner creates a new runner
@@ -22,16 +38,42 @@ type Runner struct {
 // This will help protect as much string quoting as possible
 // for example, if the goal was to run source("test.R")
 // the remoteCmdBase64 would be "c291cmNlKCJ0ZXN0LlIiKQ=="
+// How the password reaches the script depends on the script contract in opts,
+// only ContractV1 puts it on the command line
 func NewRunner(ctx context.Context, script string, url string, user string, password string, remoteCmdBase64 string, opts *runOpts) *Runner {
 	env := environ.FromOS()
+	// never let a password from the parent environment leak into the script
+	env.Unset(PasswordEnvVar)
+	stdin := opts.Stdin
+	var handshake string
 
 	cmdArgs := []string{
 		script,
 		fmt.Sprintf("--url=%s", url),
 		fmt.Sprintf("--user=%s", user),
-		fmt.Sprintf("--password=%s", password),
-		fmt.Sprintf("--remote-cmd=%s", remoteCmdBase64),
 	}
+	if opts.Contract == ContractV1 {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--password=%s", password))
+	} else {
+		cmdArgs = append(cmdArgs,
+			fmt.Sprintf("--contract-version=%d", opts.Contract),
+			fmt.Sprintf("--password-from=%s", opts.PasswordDelivery),
+		)
+		switch opts.PasswordDelivery {
+		case PasswordFromStdin:
+			// stdin only carries the password, it is set up as a pipe in Run.
+			// Chaining another stdin after it would keep a copy from it, such as
+			// from the terminal, blocked long after the script exits
+			if stdin != nil {
+				log.Debugf("ignoring stdin for user %s as it is used to hand over the password", user)
+			}
+			stdin = nil
+			handshake = password + "\n"
+		default:
+			env.Set(PasswordEnvVar, password)
+		}
+	}
+	cmdArgs = append(cmdArgs, fmt.Sprintf("--remote-cmd=%s", remoteCmdBase64))
 	if opts.Headless {
 		cmdArgs = append(cmdArgs, "--headless")
 	}
@@ -55,17 +97,136 @@ func NewRunner(ctx context.Context, script string, url string, user string, pass
 		cmdArgs = append(cmdArgs, fmt.Sprintf("--image=%s", opts.Image))
 	}
 
-	cmd := command.NewWithContext(ctx, opts.PythonPath, cmdArgs...)
+	// the context is handled in Run rather than by exec so that the
+	// script gets a chance to shut down its browser before being killed
+	cmd := command.New(opts.PythonPath, cmdArgs...)
 	cmd.Env = env.AsSlice()
-	command.WireIO(opts.Stdin, opts.Stdout, opts.Stderr).Apply(cmd)
+	setProcessGroup(cmd.Cmd)
+	// stdout and stderr are wired up in Run so it can wait on them
+	command.WireIO(stdin, nil, nil).Apply(cmd)
 	return &Runner{
-		cmd:  cmd,
-		opts: opts,
+		ctx:       ctx,
+		cmd:       cmd,
+		opts:      opts,
+		handshake: handshake,
 	}
 }
 
+// Run starts the script in its own process group and waits for it to finish.
+// Anything still running in the group once the script exits is stopped,
+// and all of the script's output is written before Run returns.
+// If the session timeout passes or the context is done first, the script's
+// process group is sent SIGTERM, followed by SIGKILL if it is still running
+// after the kill grace period. Running past the timeout or the context deadline
+// returns an error wrapping ErrTimeout, while a canceled context returns its error
 func (r *Runner) Run() error {
-	return r.cmd.Run()
+	if err := r.ctx.Err(); err != nil {
+		return err
+	}
+	if r.handshake != "" {
+		stdin, err := handshakePipe(r.handshake)
+		if err != nil {
+			return fmt.Errorf("could not set up stdin for the password: %w", err)
+		}
+		// the script has its own copy once started
+		defer stdin.Close()
+		r.cmd.Stdin = stdin
+	}
+	output, stdout, stderr, err := newOutputPipes(r.opts.Stdout, r.opts.Stderr)
+	if err != nil {
+		return fmt.Errorf("could not set up output for the script: %w", err)
+	}
+	r.cmd.Stdout, r.cmd.Stderr = stdout, stderr
+	if err := r.cmd.Start(); err != nil {
+		output.closeAll()
+		return err
+	}
+	output.started()
+	done := make(chan error, 1)
+	go func() {
+		done <- r.cmd.Wait()
+	}()
+	// the output is only complete once the process group is gone
+	defer output.wait()
+	// whichever way the script ends, don't leave its browsers behind
+	defer r.reapGroup()
+	var timeout <-chan time.Time
+	if r.opts.Timeout > 0 {
+		timer := time.NewTimer(r.opts.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-r.opts.ForceKill:
+		r.kill(done)
+		return ErrKilled
+	case <-timeout:
+		r.terminate(done)
+		return fmt.Errorf("%w after session timeout of %s", ErrTimeout, r.opts.Timeout)
+	case <-r.ctx.Done():
+		r.terminate(done)
+		if errors.Is(r.ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%w at run deadline", ErrTimeout)
+		}
+		return r.ctx.Err()
+	}
+}
+
+// handshakePipe returns the read end of a pipe holding only the handshake.
+// The write end is closed so the script reads EOF after it, and being a file
+// exec hands it to the script as is rather than copying from it
+func handshakePipe(handshake string) (*os.File, error) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	_, err = pw.WriteString(handshake)
+	if closeErr := pw.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		pr.Close()
+		return nil, err
+	}
+	return pr, nil
+}
+
+// terminate asks the process group to stop and escalates to killing
+// it if the script has not exited within the kill grace period
+func (r *Runner) terminate(done <-chan error) {
+	if err := terminateGroup(r.cmd.Process); err != nil {
+		log.Debugf("could not terminate process group of pid %d: %s", r.cmd.Process.Pid, err)
+	}
+	grace := time.NewTimer(r.opts.KillGrace)
+	defer grace.Stop()
+	select {
+	case <-done:
+		return
+	case <-r.opts.ForceKill:
+		r.kill(done)
+	case <-grace.C:
+		log.Warnf("pid %d still running %s after being asked to stop, killing its process group", r.cmd.Process.Pid, r.opts.KillGrace)
+		r.kill(done)
+	}
+}
+
+// kill kills the process group and waits for the script to exit
+func (r *Runner) kill(done <-chan error) {
+	if err := killGroup(r.cmd.Process); err != nil {
+		log.Debugf("could not kill process group of pid %d: %s", r.cmd.Process.Pid, err)
+	}
+	<-done
+}
+
+// ExitCode returns the exit code of the script, or -1 if it has
+// not exited or was ended by a signal
+func (r *Runner) ExitCode() int {
+	if r.cmd.ProcessState == nil {
+		return -1
+	}
+	return r.cmd.ProcessState.ExitCode()
 }
 
 func (r *Runner) GetOptions() runOpts {
@@ -0,0 +1,131 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dpastoor/plr/internal/output"
+	"github.com/metrumresearchgroup/wrapt"
+	"github.com/samber/lo"
+)
+
+func TestNewRunnerPassword(tt *testing.T) {
+	tests := []struct {
+		name       string
+		opts       *runOpts
+		wantArg    string
+		wantEnv    bool
+		wantInArgs bool
+	}{
+		{
+			name:       "contract v1 keeps password flag",
+			opts:       NewDefaultRunOpts(WithNoIO(), WithScriptContract(ContractV1)),
+			wantArg:    "--password=secret",
+			wantInArgs: true,
+		},
+		{
+			name:    "contract v2 env",
+			opts:    NewDefaultRunOpts(WithNoIO()),
+			wantArg: "--password-from=env",
+			wantEnv: true,
+		},
+		{
+			name:    "contract v2 stdin",
+			opts:    NewDefaultRunOpts(WithNoIO(), WithPasswordDelivery(PasswordFromStdin)),
+			wantArg: "--password-from=stdin",
+		},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+			r := NewRunner(context.Background(), "script.py", "http://localhost", "user1", "secret", "c291cmNlKCJ0ZXN0LlIiKQ==", test.opts)
+			t.A.Contains(r.cmd.Args, test.wantArg)
+			t.A.Equal(test.wantInArgs, strings.Contains(strings.Join(r.cmd.Args, " "), "secret"))
+			t.A.Equal(test.wantEnv, lo.Contains(r.cmd.Env, PasswordEnvVar+"=secret"))
+		})
+	}
+}
+
+func TestRunTimeout(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	script := filepath.Join(tt.TempDir(), "hang.sh")
+	t.R.NoError(os.WriteFile(script, []byte("trap '' TERM\nsleep 30\n"), 0o755))
+	opts := NewDefaultRunOpts(WithNoIO(), WithPythonPath("sh"), WithTimeout(100*time.Millisecond), WithKillGrace(100*time.Millisecond))
+	r := NewRunner(context.Background(), script, "http://localhost", "user1", "secret", "c291cmNlKCJ0ZXN0LlIiKQ==", opts)
+	start := time.Now()
+	err := r.Run()
+	t.R.ErrorIs(err, ErrTimeout)
+	t.A.Less(time.Since(start), 5*time.Second)
+}
+
+func TestRunReapsLeftovers(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	script := filepath.Join(tt.TempDir(), "orphan.sh")
+	// leave a process behind in the group, like a browser the script did not quit
+	t.R.NoError(os.WriteFile(script, []byte("sleep 30 &\n"), 0o755))
+	opts := NewDefaultRunOpts(WithNoIO(), WithPythonPath("sh"), WithKillGrace(time.Second))
+	r := NewRunner(context.Background(), script, "http://localhost", "user1", "secret", "c291cmNlKCJ0ZXN0LlIiKQ==", opts)
+	t.R.NoError(r.Run())
+	if runtime.GOOS == "linux" {
+		// leftovers can only be listed by name on linux
+		t.R.Len(r.Leftovers(), 1)
+		t.A.Equal("sleep", r.Leftovers()[0].Name)
+	}
+	_, alive := groupProcesses(r.cmd.Process.Pid)
+	t.A.False(alive)
+}
+
+func TestRunPasswordFromStdinIgnoresBlockingStdin(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	script := filepath.Join(tt.TempDir(), "read.sh")
+	t.R.NoError(os.WriteFile(script, []byte("read -r password\necho \"got $password\"\n"), 0o755))
+	// a stdin that never returns, like a terminal nobody types into
+	blocking, _ := io.Pipe()
+	var stdout bytes.Buffer
+	opts := NewDefaultRunOpts(
+		WithNoIO(),
+		WithPythonPath("sh"),
+		WithPasswordDelivery(PasswordFromStdin),
+		WithStdin(blocking),
+		WithStdout(&stdout),
+	)
+	r := NewRunner(context.Background(), script, "http://localhost", "user1", "secret", "c291cmNlKCJ0ZXN0LlIiKQ==", opts)
+	done := make(chan error, 1)
+	go func() {
+		done <- r.Run()
+	}()
+	select {
+	case err := <-done:
+		t.R.NoError(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the script exited")
+	}
+	t.A.Equal("got secret\n", stdout.String())
+}
+
+func TestRunWritesAllOutput(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	dir := tt.TempDir()
+	script := filepath.Join(dir, "print.sh")
+	t.R.NoError(os.WriteFile(script, []byte("i=0\nwhile [ $i -lt 200 ]; do echo \"line $i\"; echo \"err $i\" >&2; i=$((i+1)); done\necho LAST\n"), 0o755))
+	capture, err := output.NewCapture(filepath.Join(dir, "session"))
+	t.R.NoError(err)
+	opts := NewDefaultRunOpts(WithNoIO(), WithPythonPath("sh"), WithStdout(capture.Stdout), WithStderr(capture.Stderr))
+	r := NewRunner(context.Background(), script, "http://localhost", "user1", "secret", "c291cmNlKCJ0ZXN0LlIiKQ==", opts)
+	t.R.NoError(r.Run())
+	// closing right away, as the launcher does, must not lose the end of the output
+	t.R.NoError(capture.Close())
+	stdout, err := os.ReadFile(filepath.Join(capture.Dir, "stdout.log"))
+	t.R.NoError(err)
+	t.A.True(strings.HasSuffix(string(stdout), "line 199\nLAST\n"))
+	stderr, err := os.ReadFile(filepath.Join(capture.Dir, "stderr.log"))
+	t.R.NoError(err)
+	t.A.True(strings.HasSuffix(string(stderr), "err 199\n"))
+}
@@ -0,0 +1,38 @@
+package schedule
+
+import (
+	"math/rand"
+	"time"
+)
+
+// NewRand returns a random source for the seed, so a run using the
+// same seed makes the same random choices
+func NewRand(seed int64) *rand.Rand {
+	return rand.New(rand.NewSource(seed))
+}
+
+// PoissonArrivals returns n launch times, relative to the start of the run,
+// for a Poisson process averaging rate arrivals per second.
+// The gaps between arrivals are exponentially distributed
+func PoissonArrivals(rng *rand.Rand, n int, rate float64) []time.Duration {
+	arrivals := make([]time.Duration, n)
+	var at float64
+	for i := range arrivals {
+		at += rng.ExpFloat64() / rate
+		arrivals[i] = time.Duration(at * float64(time.Second))
+	}
+	return arrivals
+}
+
+// Jitter shifts d by a uniformly distributed amount between -jitter and +jitter,
+// never returning less than 0
+func Jitter(rng *rand.Rand, d time.Duration, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return d
+	}
+	d += time.Duration((rng.Float64()*2 - 1) * float64(jitter))
+	if d < 0 {
+		return 0
+	}
+	return d
+}
@@ -0,0 +1,33 @@
+package schedule_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dpastoor/plr/internal/schedule"
+	"github.com/metrumresearchgroup/wrapt"
+)
+
+func TestPoissonArrivals(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	arrivals := schedule.PoissonArrivals(schedule.NewRand(42), 2000, 4)
+	t.R.Len(arrivals, 2000)
+	for i := 1; i < len(arrivals); i++ {
+		t.R.GreaterOrEqual(arrivals[i], arrivals[i-1])
+	}
+	// 2000 arrivals at 4 per second should take roughly 500 seconds
+	t.A.InDelta(500, arrivals[len(arrivals)-1].Seconds(), 50)
+	t.A.Equal(arrivals, schedule.PoissonArrivals(schedule.NewRand(42), 2000, 4), "same seed must give the same arrivals")
+}
+
+func TestJitter(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	rng := schedule.NewRand(1)
+	for i := 0; i < 100; i++ {
+		d := schedule.Jitter(rng, 10*time.Second, 2*time.Second)
+		t.R.GreaterOrEqual(d, 8*time.Second)
+		t.R.LessOrEqual(d, 12*time.Second)
+	}
+	t.A.Equal(time.Duration(0), schedule.Jitter(rng, 0, 0))
+	t.A.GreaterOrEqual(schedule.Jitter(rng, 0, time.Second), time.Duration(0))
+}
@@ -0,0 +1,61 @@
+package schedule
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+)
+
+// Picker chooses which session from a pool to launch next
+type Picker interface {
+	// Next returns the index of the next session in the pool
+	Next() int
+}
+
+type roundRobin struct {
+	n    int
+	next int
+}
+
+// NewRoundRobin cycles through a pool of n sessions in order
+func NewRoundRobin(n int) Picker {
+	return &roundRobin{n: n}
+}
+
+func (r *roundRobin) Next() int {
+	i := r.next
+	r.next = (r.next + 1) % r.n
+	return i
+}
+
+type weighted struct {
+	rng        *rand.Rand
+	cumulative []float64
+}
+
+// NewWeighted picks sessions at random, each with a chance
+// proportional to its weight
+func NewWeighted(rng *rand.Rand, weights []float64) (Picker, error) {
+	cumulative := make([]float64, len(weights))
+	total := 0.0
+	for i, w := range weights {
+		if w < 0 {
+			return nil, errors.New("weights must not be negative")
+		}
+		total += w
+		cumulative[i] = total
+	}
+	if total <= 0 {
+		return nil, errors.New("at least one weight must be greater than 0")
+	}
+	return &weighted{rng: rng, cumulative: cumulative}, nil
+}
+
+func (w *weighted) Next() int {
+	target := w.rng.Float64() * w.cumulative[len(w.cumulative)-1]
+	// the first session whose cumulative weight is above the target,
+	// which also skips any sessions with a weight of 0
+	return sort.Search(len(w.cumulative), func(i int) bool {
+		return w.cumulative[i] > target
+	})
+}
@@ -0,0 +1,34 @@
+package schedule_test
+
+import (
+	"testing"
+
+	"github.com/dpastoor/plr/internal/schedule"
+	"github.com/metrumresearchgroup/wrapt"
+)
+
+func TestRoundRobin(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	p := schedule.NewRoundRobin(3)
+	var got []int
+	for i := 0; i < 7; i++ {
+		got = append(got, p.Next())
+	}
+	t.A.Equal([]int{0, 1, 2, 0, 1, 2, 0}, got)
+}
+
+func TestWeighted(tt *testing.T) {
+	t := wrapt.WrapT(tt)
+	p, err := schedule.NewWeighted(schedule.NewRand(3), []float64{1, 0, 3})
+	t.R.NoError(err)
+	counts := make([]int, 3)
+	for i := 0; i < 4000; i++ {
+		counts[p.Next()]++
+	}
+	t.A.Equal(0, counts[1])
+	t.A.InDelta(1000, counts[0], 150)
+	t.A.InDelta(3000, counts[2], 150)
+
+	_, err = schedule.NewWeighted(schedule.NewRand(3), []float64{0, 0})
+	t.A.Error(err)
+}
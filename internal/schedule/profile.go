@@ -0,0 +1,55 @@
+package schedule
+
+import (
+	"math"
+	"time"
+
+	"github.com/dpastoor/plr/internal/config"
+)
+
+// Stage moves the target number of concurrent sessions linearly
+// from the target of the previous stage to Target over Duration
+type Stage struct {
+	Duration time.Duration
+	Target   int
+}
+
+// Profile is a series of stages describing the number of concurrent
+// sessions over time, starting from 0 concurrent sessions
+type Profile []Stage
+
+// NewProfile creates a Profile from the scenarios profile
+func NewProfile(profile config.Profile) Profile {
+	p := make(Profile, len(profile.Stages))
+	for i, stage := range profile.Stages {
+		p[i] = Stage{
+			Duration: time.Duration(stage.Duration * float64(time.Second)),
+			Target:   stage.Target,
+		}
+	}
+	return p
+}
+
+// Duration is the total duration of all stages
+func (p Profile) Duration() time.Duration {
+	var d time.Duration
+	for _, stage := range p {
+		d += stage.Duration
+	}
+	return d
+}
+
+// Target returns the number of concurrent sessions wanted at elapsed
+// time into the profile. After the last stage the final target is kept
+func (p Profile) Target(elapsed time.Duration) int {
+	from := 0
+	for _, stage := range p {
+		if elapsed < stage.Duration {
+			progress := float64(elapsed) / float64(stage.Duration)
+			return from + int(math.Round(progress*float64(stage.Target-from)))
+		}
+		elapsed -= stage.Duration
+		from = stage.Target
+	}
+	return from
+}
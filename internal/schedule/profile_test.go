@@ -0,0 +1,38 @@
+package schedule_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dpastoor/plr/internal/config"
+	"github.com/dpastoor/plr/internal/schedule"
+	"github.com/metrumresearchgroup/wrapt"
+)
+
+func TestProfileTarget(tt *testing.T) {
+	// ramp to 10 over 10s, hold for 5s, ramp down over 5s
+	profile := schedule.NewProfile(config.Profile{Stages: []config.Stage{
+		{Duration: 10, Target: 10},
+		{Duration: 5, Target: 10},
+		{Duration: 5, Target: 0},
+	}})
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		want    int
+	}{
+		{name: "start", elapsed: 0, want: 0},
+		{name: "ramping up", elapsed: 5 * time.Second, want: 5},
+		{name: "end of ramp", elapsed: 10 * time.Second, want: 10},
+		{name: "holding", elapsed: 12 * time.Second, want: 10},
+		{name: "ramping down", elapsed: 18 * time.Second, want: 4},
+		{name: "after end", elapsed: 30 * time.Second, want: 0},
+	}
+	for _, test := range tests {
+		tt.Run(test.name, func(tt *testing.T) {
+			t := wrapt.WrapT(tt)
+			t.A.Equal(test.want, profile.Target(test.elapsed))
+		})
+	}
+	wrapt.WrapT(tt).A.Equal(20*time.Second, profile.Duration())
+}
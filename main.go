@@ -24,5 +24,5 @@ func main() {
 		os.Setenv("XDG_DATA_HOME", filepath.Join(hd, ".local", "share"))
 		xdg.Reload()
 	}
-	cmd.Execute(version, os.Args[1:])
+	cmd.Execute(version, commit, date, os.Args[1:])
 }